@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// The settings a campaign was started with, saved by commands which carry it on later (apply, continue) so it runs
+// exactly as it was started
+type campaign struct {
+	Version       string    `json:"version"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Org           string    `json:"org"`
+	BranchName    string    `json:"branchName"`
+	DefaultBranch string    `json:"defaultBranch"`
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	Script        string    `json:"script,omitempty"`
+	Patch         string    `json:"patch,omitempty"`
+	PatchFuzz     int       `json:"patchFuzz,omitempty"`
+	PatchThreeWay bool      `json:"patchThreeWay,omitempty"`
+	PerDir        string    `json:"perDir,omitempty"`
+	Verify        string    `json:"verify,omitempty"`
+	ExitCodes     string    `json:"exitCodes,omitempty"`
+	Config        string    `json:"config,omitempty"`
+}
+
+// Capture the campaign's settings from the validated flags
+func currentCampaign() (campaign, error) {
+	c := campaign{
+		Version:       Version,
+		CreatedAt:     time.Now().UTC(),
+		Org:           org,
+		BranchName:    branchName,
+		DefaultBranch: defaultBranch,
+		Title:         title,
+		Description:   description,
+		Script:        script,
+		Patch:         patchFile,
+		PatchFuzz:     patchFuzz,
+		PatchThreeWay: patchThreeWay,
+		PerDir:        perDirGlob,
+		Verify:        verifyCommand,
+		ExitCodes:     exitCodesSpec,
+	}
+	if configFile != "" {
+		var err error
+		c.Config, err = filepath.Abs(configFile)
+		if err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// Restore the campaign's settings and prepare to open pull requests with them
+func (c *campaign) restore() error {
+	org = c.Org
+	branchName = c.BranchName
+	defaultBranch = c.DefaultBranch
+	title = c.Title
+	description = c.Description
+	script = c.Script
+	patchFile = c.Patch
+	patchFuzz = c.PatchFuzz
+	patchThreeWay = c.PatchThreeWay
+	perDirGlob = c.PerDir
+	verifyCommand = c.Verify
+	if c.ExitCodes != "" {
+		exitCodesSpec = c.ExitCodes
+	}
+	configFile = c.Config
+	makePr = true
+
+	_, err := exec.LookPath("gh")
+	if err != nil {
+		return fmt.Errorf("The github cli is required to make a pull request. Please run:\nbrew install github/gh/gh")
+	}
+	err = loadRunSettings()
+	if err != nil {
+		return err
+	}
+	return initPushing()
+}
@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Formats the differences between two runs can be reported in
+const (
+	diffFormatText     = "text"
+	diffFormatJson     = "json"
+	diffFormatMarkdown = "markdown"
+)
+
+var diffFormat string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old-results> <new-results>",
+	Short: "Compare the results of two runs",
+	Long: `Compare the results of two runs.
+
+Reports the repositories only in one of the results files, the repositories whose outcome changed (e.g. failed to
+succeeded), and how the stdout of each repository changed. When stdout is JSON in both runs the values which changed
+are reported by path, otherwise the lines which were added and removed. Results logs (.jsonl) can be compared too.`,
+	Args:         cobra.ExactArgs(2),
+	RunE:         runDiff,
+	SilenceUsage: true,
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffFormat, "output", diffFormatText, "(optional) Format of the report, 'text', 'json' or 'markdown'")
+	rootCmd.AddCommand(diffCmd)
+}
+
+// Differences between the results of two runs
+type resultsDiff struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Repos only in the new results, with their outcome
+	Added map[string]string `json:"added"`
+	// Repos only in the old results, with their outcome
+	Removed   map[string]string `json:"removed"`
+	Changed   []*repoDiff       `json:"changed"`
+	Unchanged int               `json:"unchanged"`
+}
+
+// Differences between the results of a repo in two runs
+type repoDiff struct {
+	Repo       string `json:"repo"`
+	OldOutcome string `json:"oldOutcome,omitempty"`
+	NewOutcome string `json:"newOutcome,omitempty"`
+	// Lines of stdout only in the new or only in the old run, when stdout isn't JSON
+	StdoutAdded   []string `json:"stdoutAdded,omitempty"`
+	StdoutRemoved []string `json:"stdoutRemoved,omitempty"`
+	// Values which changed, when stdout is JSON in both runs
+	JsonChanges []*jsonChange `json:"jsonChanges,omitempty"`
+}
+
+// A value in JSON output which was added, removed or changed
+type jsonChange struct {
+	// Path of the value, e.g. .deps[2].name
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if diffFormat != diffFormatText && diffFormat != diffFormatJson && diffFormat != diffFormatMarkdown {
+		return fmt.Errorf("Unknown --output '%s', expected '%s', '%s' or '%s'", diffFormat, diffFormatText, diffFormatJson, diffFormatMarkdown)
+	}
+	oldResults, err := loadResults(args[0])
+	if err != nil {
+		return fmt.Errorf("error loading results: %w", err)
+	}
+	newResults, err := loadResults(args[1])
+	if err != nil {
+		return fmt.Errorf("error loading results: %w", err)
+	}
+
+	d := diffResults(oldResults, newResults)
+	d.Old = args[0]
+	d.New = args[1]
+	switch diffFormat {
+	case diffFormatJson:
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case diffFormatMarkdown:
+		fmt.Print(d.markdown())
+	default:
+		fmt.Print(d.text())
+	}
+	return nil
+}
+
+// Compare the results of each repo in two runs
+func diffResults(oldResults, newResults map[string]*runResults) *resultsDiff {
+	d := &resultsDiff{Added: map[string]string{}, Removed: map[string]string{}, Changed: []*repoDiff{}}
+	for repoName, r := range oldResults {
+		if _, ok := newResults[repoName]; !ok {
+			d.Removed[repoName] = r.Outcome
+		}
+	}
+
+	var repoNames []string
+	for repoName := range newResults {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	for _, repoName := range repoNames {
+		newR := newResults[repoName]
+		oldR, ok := oldResults[repoName]
+		if !ok {
+			d.Added[repoName] = newR.Outcome
+			continue
+		}
+		rd := diffRepo(repoName, oldR, newR)
+		if rd == nil {
+			d.Unchanged++
+			continue
+		}
+		d.Changed = append(d.Changed, rd)
+	}
+	return d
+}
+
+// Compare the results of a repo in two runs, nil if nothing changed
+func diffRepo(repoName string, oldR, newR *runResults) *repoDiff {
+	rd := &repoDiff{Repo: repoName}
+	changed := false
+	if oldR.Outcome != newR.Outcome {
+		rd.OldOutcome = oldR.Outcome
+		rd.NewOutcome = newR.Outcome
+		changed = true
+	}
+	if oldR.Stdout == newR.Stdout {
+		if !changed {
+			return nil
+		}
+		return rd
+	}
+
+	var oldValue, newValue interface{}
+	if json.Unmarshal([]byte(oldR.Stdout), &oldValue) == nil && json.Unmarshal([]byte(newR.Stdout), &newValue) == nil {
+		rd.JsonChanges = diffJson("", oldValue, newValue)
+	} else {
+		rd.StdoutRemoved, rd.StdoutAdded = diffLines(oldR.Stdout, newR.Stdout)
+	}
+	if !changed && len(rd.JsonChanges) == 0 && len(rd.StdoutAdded) == 0 && len(rd.StdoutRemoved) == 0 {
+		// Only formatting or the order of lines changed
+		return nil
+	}
+	return rd
+}
+
+// Values which differ between two parsed JSON documents, by path
+func diffJson(path string, oldValue, newValue interface{}) []*jsonChange {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return nil
+	}
+	switch oldV := oldValue.(type) {
+	case map[string]interface{}:
+		newV, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]bool{}
+		for k := range oldV {
+			keys[k] = true
+		}
+		for k := range newV {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		var changes []*jsonChange
+		for _, k := range sorted {
+			changes = append(changes, diffJson(path+"."+k, oldV[k], newV[k])...)
+		}
+		return changes
+	case []interface{}:
+		newV, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+		var changes []*jsonChange
+		for i := 0; i < len(oldV) || i < len(newV); i++ {
+			var o, n interface{}
+			if i < len(oldV) {
+				o = oldV[i]
+			}
+			if i < len(newV) {
+				n = newV[i]
+			}
+			changes = append(changes, diffJson(fmt.Sprintf("%s[%d]", path, i), o, n)...)
+		}
+		return changes
+	}
+	if path == "" {
+		path = "."
+	}
+	return []*jsonChange{{Path: path, Old: oldValue, New: newValue}}
+}
+
+// Lines only in old and only in new output, ignoring their order
+func diffLines(oldText, newText string) (removed, added []string) {
+	counts := map[string]int{}
+	for _, line := range splitLines(oldText) {
+		counts[line]++
+	}
+	for _, line := range splitLines(newText) {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+	for _, line := range splitLines(oldText) {
+		if counts[line] > 0 {
+			counts[line]--
+			removed = append(removed, line)
+		}
+	}
+	return removed, added
+}
+
+// Non-empty lines of some output
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Format a JSON value on a single line, or a dash if it wasn't there
+func jsonValue(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// Sorted keys of repos added or removed
+func sortedRepos(repos map[string]string) []string {
+	var repoNames []string
+	for repoName := range repos {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	return repoNames
+}
+
+func (d *resultsDiff) text() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Comparing %s with %s\n", d.Old, d.New)
+	for _, repoName := range sortedRepos(d.Added) {
+		fmt.Fprintf(b, "%s: ➕ ADDED, %s\n", repoName, d.Added[repoName])
+	}
+	for _, repoName := range sortedRepos(d.Removed) {
+		fmt.Fprintf(b, "%s: ➖ REMOVED, was %s\n", repoName, d.Removed[repoName])
+	}
+	for _, rd := range d.Changed {
+		if rd.OldOutcome != rd.NewOutcome {
+			fmt.Fprintf(b, "%s: %s → %s\n", rd.Repo, rd.OldOutcome, rd.NewOutcome)
+		}
+		for _, c := range rd.JsonChanges {
+			fmt.Fprintf(b, "%s: %s: %s → %s\n", rd.Repo, c.Path, jsonValue(c.Old), jsonValue(c.New))
+		}
+		for _, line := range rd.StdoutRemoved {
+			fmt.Fprintf(b, "%s: - %s\n", rd.Repo, line)
+		}
+		for _, line := range rd.StdoutAdded {
+			fmt.Fprintf(b, "%s: + %s\n", rd.Repo, line)
+		}
+	}
+	fmt.Fprintf(b, "%d added, %d removed, %d changed, %d unchanged\n", len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged)
+	return b.String()
+}
+
+func (d *resultsDiff) markdown() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "## Comparing `%s` with `%s`\n\n", d.Old, d.New)
+	fmt.Fprintf(b, "%d added, %d removed, %d changed, %d unchanged\n", len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged)
+
+	if len(d.Added)+len(d.Removed) > 0 {
+		b.WriteString("\n### Added and removed\n\n| Repo | Change | Outcome |\n| --- | --- | --- |\n")
+		for _, repoName := range sortedRepos(d.Added) {
+			fmt.Fprintf(b, "| %s | added | %s |\n", markdownCell(repoName), d.Added[repoName])
+		}
+		for _, repoName := range sortedRepos(d.Removed) {
+			fmt.Fprintf(b, "| %s | removed | %s |\n", markdownCell(repoName), d.Removed[repoName])
+		}
+	}
+
+	var outcomes, outputs []*repoDiff
+	for _, rd := range d.Changed {
+		if rd.OldOutcome != rd.NewOutcome {
+			outcomes = append(outcomes, rd)
+		}
+		if len(rd.JsonChanges)+len(rd.StdoutAdded)+len(rd.StdoutRemoved) > 0 {
+			outputs = append(outputs, rd)
+		}
+	}
+	if len(outcomes) > 0 {
+		b.WriteString("\n### Outcome changes\n\n| Repo | Old | New |\n| --- | --- | --- |\n")
+		for _, rd := range outcomes {
+			fmt.Fprintf(b, "| %s | %s | %s |\n", markdownCell(rd.Repo), rd.OldOutcome, rd.NewOutcome)
+		}
+	}
+	if len(outputs) > 0 {
+		b.WriteString("\n### Output changes\n")
+		for _, rd := range outputs {
+			fmt.Fprintf(b, "\n<details><summary>%s</summary>\n\n```diff\n", rd.Repo)
+			for _, c := range rd.JsonChanges {
+				if c.Old != nil {
+					fmt.Fprintf(b, "- %s: %s\n", c.Path, jsonValue(c.Old))
+				}
+				if c.New != nil {
+					fmt.Fprintf(b, "+ %s: %s\n", c.Path, jsonValue(c.New))
+				}
+			}
+			for _, line := range rd.StdoutRemoved {
+				fmt.Fprintf(b, "- %s\n", line)
+			}
+			for _, line := range rd.StdoutAdded {
+				fmt.Fprintf(b, "+ %s\n", line)
+			}
+			b.WriteString("```\n\n</details>\n")
+		}
+	}
+	return b.String()
+}
+
+// Escape text for a markdown table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
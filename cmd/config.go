@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Campaign configuration, read from the JSON file passed with --config
+type config struct {
+	// Steps to run in each repository instead of a single script
+	Pipeline []*pipelineStep `json:"pipeline"`
+	// Rules for committing changes to some paths separately, e.g. vendored dependencies
+	CommitSplits []*commitSplit `json:"commitSplits"`
+	// Limits on what may be changed before anything is committed
+	Guards *guards `json:"guards"`
+}
+
+// Path to the config file and its parsed contents
+var (
+	configFile string
+	cfg        = &config{}
+)
+
+// Register the --config flag on a command
+func addConfigFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&configFile, "config", "", "(optional) Path to a JSON campaign config file, e.g. defining a pipeline of steps, commit splitting rules or guards")
+}
+
+// Read and validate the config file, if one was given
+func loadConfig() error {
+	if configFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	c := &config{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return fmt.Errorf("error parsing config %s: %w", configFile, err)
+	}
+	err = validatePipeline(c.Pipeline)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline in %s: %w", configFile, err)
+	}
+	err = validateCommitSplits(c.CommitSplits)
+	if err != nil {
+		return fmt.Errorf("invalid commitSplits in %s: %w", configFile, err)
+	}
+	if c.Guards != nil {
+		err = c.Guards.validate()
+		if err != nil {
+			return fmt.Errorf("invalid guards in %s: %w", configFile, err)
+		}
+	}
+	cfg = c
+	return nil
+}
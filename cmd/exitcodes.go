@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit code which skips a repo unless --exit-codes says otherwise
+const (
+	defaultSkipExitCode = 10
+	defaultExitCodes    = "10=skip"
+)
+
+// A kind of outcome a script can report with its exit code
+type exitCodeCategory struct {
+	// Name used in --exit-codes
+	name    string
+	outcome string
+	// Whether the change may still be committed and a PR opened for it
+	allowsPr bool
+}
+
+// Categories in order of how much attention they need
+var exitCodeCategories = []*exitCodeCategory{
+	{name: "skip", outcome: outcomeSkipped},
+	{name: "warn", outcome: outcomeWarned, allowsPr: true},
+	{name: "manual", outcome: outcomeManual, allowsPr: true},
+	{name: "fail", outcome: outcomeFailed},
+}
+
+var (
+	exitCodesSpec = defaultExitCodes
+	// Category of every exit code given a meaning by --exit-codes, the default until it's parsed
+	exitCodes = map[int]*exitCodeCategory{defaultSkipExitCode: exitCodeCategoryNamed("skip")}
+)
+
+// Register the --exit-codes flag on a command
+func addExitCodesFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&exitCodesSpec, "exit-codes", defaultExitCodes, "(optional) Meaning of script exit codes as CODE=CATEGORY pairs, e.g. '10=skip,20=warn,30=manual'. Categories are skip, warn, manual and fail")
+}
+
+// Parse --exit-codes into the category of each code
+func parseExitCodes() error {
+	codes := map[int]*exitCodeCategory{}
+	for _, pair := range strings.Split(exitCodesSpec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		codeStr, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("Invalid exit code '%s', expected CODE=CATEGORY", pair)
+		}
+		code, err := strconv.Atoi(strings.TrimSpace(codeStr))
+		if err != nil || code <= 0 || code > 255 {
+			return fmt.Errorf("Invalid exit code '%s', expected a number from 1 to 255", codeStr)
+		}
+		category := exitCodeCategoryNamed(strings.TrimSpace(name))
+		if category == nil {
+			return fmt.Errorf("Unknown exit code category '%s', expected one of %s", name, strings.Join(exitCodeCategoryNames(), ", "))
+		}
+		if _, ok := codes[code]; ok {
+			return fmt.Errorf("Exit code %d is given more than once", code)
+		}
+		codes[code] = category
+	}
+	exitCodes = codes
+	return nil
+}
+
+func exitCodeCategoryNamed(name string) *exitCodeCategory {
+	for _, c := range exitCodeCategories {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func exitCodeCategoryNames() []string {
+	var names []string
+	for _, c := range exitCodeCategories {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// Map a script exit code to the outcome of the run
+func outcomeForExitCode(exitCode int) string {
+	if exitCode == 0 {
+		return outcomeSucceeded
+	}
+	if category, ok := exitCodes[exitCode]; ok {
+		return category.outcome
+	}
+	return outcomeFailed
+}
+
+// Whether a change with this outcome may be checked, committed and have a PR opened for it
+func outcomeAllowsPr(outcome string) bool {
+	if outcome == outcomeSucceeded {
+		return true
+	}
+	for _, c := range exitCodeCategories {
+		if c.outcome == outcome {
+			return c.allowsPr
+		}
+	}
+	return false
+}
+
+// The outcome which needs the most attention, used when a repo has several, e.g. one per directory
+func worseOutcome(a, b string) string {
+	if outcomeRank(b) > outcomeRank(a) {
+		return b
+	}
+	return a
+}
+
+func outcomeRank(outcome string) int {
+	for i, c := range exitCodeCategories {
+		if c.outcome == outcome {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Formats supported by --export
+const (
+	exportMbox   = "mbox"
+	exportBundle = "bundle"
+)
+
+// Check the export flags and read the commit author, since exported changes are committed locally
+func validateExportArgs() error {
+	for _, format := range exportFormats {
+		if format != exportMbox && format != exportBundle {
+			return fmt.Errorf("Unknown export format '%s', expected '%s' or '%s'", format, exportMbox, exportBundle)
+		}
+	}
+	if title == "" {
+		return fmt.Errorf("A commit title is required when exporting. Pass one with -t")
+	}
+	return initGitAuthor()
+}
+
+// Directory exported changes are written to for the current branch
+func exportDir() string {
+	return filepath.Join(".", "results", resultsName())
+}
+
+// Commit the changes locally and write them to the export directory in every requested format.
+// Returns the paths of the written files, or nothing if the script made no changes
+func exportChanges(repoName string, repoPath string, repo *git.Repository, base plumbing.Hash) ([]string, error) {
+	ahead, err := commitBranch(repoName, repo, title, base)
+	if err != nil {
+		return nil, err
+	}
+	if !ahead {
+		return nil, nil
+	}
+
+	err = os.MkdirAll(exportDir(), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("error creating export directory: %w", err)
+	}
+
+	revRange := fmt.Sprintf("%s..%s", defaultBranch, branchName)
+	// Repos qualified as org/repo are exported alongside the others
+	exportName := strings.ReplaceAll(repoName, "/", "-")
+	var exports []string
+	for _, format := range exportFormats {
+		var fp string
+		switch format {
+		case exportMbox:
+			fp = filepath.Join(exportDir(), exportName+".mbox")
+			fmt.Printf("%s: 📦 Exporting patches to %s\n", repoName, fp)
+			stdout, stderr, exitCode, err := runCommand(repoPath, "git", "format-patch", "--stdout", revRange)
+			if err != nil {
+				return nil, fmt.Errorf("error running git format-patch: %w", err)
+			}
+			if exitCode != 0 {
+				return nil, fmt.Errorf("error running git format-patch: %s", stderr)
+			}
+			err = os.WriteFile(fp, stdout, 0600)
+			if err != nil {
+				return nil, err
+			}
+		case exportBundle:
+			fp = filepath.Join(exportDir(), exportName+".bundle")
+			absPath, err := filepath.Abs(fp)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf("%s: 📦 Exporting bundle to %s\n", repoName, fp)
+			_, stderr, exitCode, err := runCommand(repoPath, "git", "bundle", "create", absPath, revRange)
+			if err != nil {
+				return nil, fmt.Errorf("error running git bundle: %w", err)
+			}
+			if exitCode != 0 {
+				return nil, fmt.Errorf("error running git bundle: %s", stderr)
+			}
+			err = os.Chmod(absPath, 0600)
+			if err != nil {
+				return nil, err
+			}
+		}
+		exports = append(exports, fp)
+	}
+	return exports, nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// Limits on what a campaign may change, checked before anything is committed
+type guards struct {
+	MaxFilesChanged int `json:"maxFilesChanged"`
+	MaxLinesAdded   int `json:"maxLinesAdded"`
+	MaxLinesRemoved int `json:"maxLinesRemoved"`
+	// Globs of paths which may not be changed, e.g. ".github/workflows/**"
+	ForbiddenPaths []string `json:"forbiddenPaths"`
+	// Refuse changes which delete files
+	NoDeletions bool `json:"noDeletions"`
+}
+
+// Check the guards are well formed
+func (g *guards) validate() error {
+	if g.MaxFilesChanged < 0 || g.MaxLinesAdded < 0 || g.MaxLinesRemoved < 0 {
+		return fmt.Errorf("limits can't be negative")
+	}
+	for _, pattern := range g.ForbiddenPaths {
+		err := validateGlob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid forbidden path '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Whether any guard is set
+func (g *guards) enabled() bool {
+	return g.MaxFilesChanged > 0 || g.MaxLinesAdded > 0 || g.MaxLinesRemoved > 0 ||
+		len(g.ForbiddenPaths) > 0 || g.NoDeletions
+}
+
+// Check the changes against the guards, returning a reason for every violation
+func (g *guards) check(changes []*fileChange) []string {
+	var violations []string
+	added, removed := 0, 0
+	for _, c := range changes {
+		added += c.Added
+		removed += c.Removed
+		for _, pattern := range g.ForbiddenPaths {
+			if matchGlob(pattern, c.Path) {
+				violations = append(violations, fmt.Sprintf("%s matches forbidden path %s", c.Path, pattern))
+				break
+			}
+		}
+		if g.NoDeletions && c.Status == "D" {
+			violations = append(violations, fmt.Sprintf("%s was deleted", c.Path))
+		}
+	}
+	if g.MaxFilesChanged > 0 && len(changes) > g.MaxFilesChanged {
+		violations = append(violations, fmt.Sprintf("%d files changed, more than the maximum of %d", len(changes), g.MaxFilesChanged))
+	}
+	if g.MaxLinesAdded > 0 && added > g.MaxLinesAdded {
+		violations = append(violations, fmt.Sprintf("%d lines added, more than the maximum of %d", added, g.MaxLinesAdded))
+	}
+	if g.MaxLinesRemoved > 0 && removed > g.MaxLinesRemoved {
+		violations = append(violations, fmt.Sprintf("%d lines removed, more than the maximum of %d", removed, g.MaxLinesRemoved))
+	}
+	return violations
+}
+
+// Check a successful change against the config's guards, marking the results as outcomeGuardViolation if any are broken
+func guardRepo(repoName, repoPath string, r *runResults) error {
+	if cfg.Guards == nil || !cfg.Guards.enabled() || !outcomeAllowsPr(r.Outcome) {
+		return nil
+	}
+
+	snapshot, err := snapshotWorktree(repoPath)
+	if err != nil {
+		return err
+	}
+	defer snapshot.cleanup()
+	changes, err := snapshot.changedFiles(r.BaseCommit)
+	if err != nil {
+		return err
+	}
+
+	r.GuardViolations = cfg.Guards.check(changes)
+	if len(r.GuardViolations) > 0 {
+		r.Outcome = outcomeGuardViolation
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Decisions made when reviewing a change with --interactive
+const (
+	decisionApproved = "approved"
+	decisionSkipped  = "skipped"
+	// The change was skipped and no further repos were run
+	decisionAborted = "aborted"
+)
+
+var (
+	interactive bool
+
+	// Shared so input typed ahead of a prompt isn't lost between repos
+	promptReader = bufio.NewReader(os.Stdin)
+)
+
+// Check --interactive can prompt for a decision
+func validateInteractiveArgs() error {
+	if !makePr {
+		return fmt.Errorf("--interactive reviews changes before they are pushed, so it requires --make-pr")
+	}
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("--interactive requires a terminal to prompt on")
+	}
+	return nil
+}
+
+// Show a successful change to the user and ask whether to push it.
+// Records the decision in the results, along with the commit message if it was edited
+func reviewChange(repoName, repoPath string, r *runResults) error {
+	err := printDiffStat(repoName, repoPath, r.BaseCommit)
+	if err != nil {
+		return err
+	}
+
+	for {
+		fmt.Printf("%s: Push and open a PR? [y]es, [n]o/skip, [d]iff, [e]dit message, [s]hell, [a]bort, [?] help: ", repoName)
+		line, err := promptReader.ReadString('\n')
+		if err != nil {
+			// Treat a closed stdin as aborting, there's nobody left to ask
+			fmt.Println()
+			r.Decision = decisionAborted
+			return nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			r.Decision = decisionApproved
+			return nil
+		case "n", "no":
+			r.Decision = decisionSkipped
+			return nil
+		case "a", "abort":
+			r.Decision = decisionAborted
+			return nil
+		case "d", "diff":
+			err = pageDiff(repoPath, r.BaseCommit)
+		case "e", "edit":
+			err = editCommitMessage(r)
+		case "s", "shell":
+			err = openShell(repoName, repoPath, r)
+			if err == nil && !outcomeAllowsPr(r.Outcome) {
+				// The change no longer passes its checks, so there is nothing to push
+				return nil
+			}
+		default:
+			fmt.Println("  y  push the change and open a pull request")
+			fmt.Println("  n  skip this repo, nothing is pushed")
+			fmt.Println("  d  page the full diff")
+			fmt.Println("  e  edit the commit message")
+			fmt.Println("  s  open a shell in the worktree, the change is checked again when it exits")
+			fmt.Println("  a  skip this repo and stop the run")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Print a summary of the files changed since base, including untracked files
+func printDiffStat(repoName, repoPath, base string) error {
+	snapshot, err := snapshotWorktree(repoPath)
+	if err != nil {
+		return err
+	}
+	defer snapshot.cleanup()
+	stat, err := snapshot.diff(base, "--stat", "--color=always")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: Changes to be pushed:\n%s", repoName, stat)
+	return nil
+}
+
+// Show the full diff since base in $PAGER
+func pageDiff(repoPath, base string) error {
+	snapshot, err := snapshotWorktree(repoPath)
+	if err != nil {
+		return err
+	}
+	defer snapshot.cleanup()
+	diff, err := snapshot.diff(base, "--color=always", "--no-ext-diff")
+	if err != nil {
+		return err
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+	c := exec.Command("sh", "-c", pager)
+	c.Stdin = strings.NewReader(string(diff))
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err = c.Run()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return fmt.Errorf("error running pager: %w", err)
+	}
+	return nil
+}
+
+// Let the user edit the commit message in $EDITOR
+func editCommitMessage(r *runResults) error {
+	tmp, err := os.CreateTemp("", "repository-mapper-message-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(r.commitMessage() + "\n")
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	c := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmp.Name())
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err = c.Run()
+	if err != nil {
+		return fmt.Errorf("error running editor: %w", err)
+	}
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		fmt.Println("Empty commit message, keeping the previous one")
+		return nil
+	}
+	r.CommitMessage = message
+	return nil
+}
+
+// Open an interactive shell in the worktree, then check the change again since it may have been edited
+func openShell(repoName, repoPath string, r *runResults) error {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "sh"
+	}
+	fmt.Printf("%s: Opening %s in %s, exit the shell to return to the review\n", repoName, shell, repoPath)
+	c := exec.Command(shell)
+	c.Dir = repoPath
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err := c.Run()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return fmt.Errorf("error running shell: %w", err)
+	}
+
+	err = checkRepo(repoName, repoPath, r)
+	if err != nil {
+		return err
+	}
+	if !outcomeAllowsPr(r.Outcome) {
+		return nil
+	}
+	return printDiffStat(repoName, repoPath, r.BaseCommit)
+}
+
+// Message to commit the change with, the PR title unless it was edited during review
+func (r *runResults) commitMessage() string {
+	if r.CommitMessage != "" {
+		return r.CommitMessage
+	}
+	return title
+}
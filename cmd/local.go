@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Check the flags for --local mode. A branch name is optional, if given the changes are committed to it
+func validateLocalArgs() error {
+	if branchName == "" {
+		return nil
+	}
+	if title == "" {
+		return fmt.Errorf("A commit title is required when committing to a local branch. Pass one with -t")
+	}
+	return initGitAuthor()
+}
+
+// Run the script in an existing local repository.
+// Unlike runRepo the repository is never cloned or deleted, and nothing is pushed
+func runLocalRepo(dir string) (*runResults, error) {
+	repoPath, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	repoName := localRepoName(dir)
+	fmt.Printf("%s: Using local repository at %s\n", repoName, repoPath)
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	var phases []*phaseTiming
+	if branchName != "" {
+		start := startPhase(repoName, phaseCheckout)
+		err = checkoutLocalBranch(repoName, repo)
+		if err != nil {
+			return nil, err
+		}
+		phases = append(phases, endPhase(phaseCheckout, start))
+	}
+
+	r, err := runInRepo(repoName, repoPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	r.Path = repoPath
+	r.Phases = append(phases, r.Phases...)
+
+	if branchName != "" && outcomeAllowsPr(r.Outcome) {
+		start := startPhase(repoName, phaseCommit)
+		committed, err := commitChanges(repoName, repo, title)
+		if err != nil {
+			return nil, err
+		}
+		r.addPhase(phaseCommit, start)
+		if committed {
+			r.setResultCommit(repo)
+		}
+	}
+	return r, nil
+}
+
+// Name a local repo is logged and its transcripts written under. This is the path as given rather than its
+// directory name, so repos in different directories with the same name don't collide
+func localRepoName(dir string) string {
+	name := filepath.ToSlash(filepath.Clean(dir))
+	if name == "." {
+		if abs, err := filepath.Abs(dir); err == nil {
+			return filepath.Base(abs)
+		}
+	}
+	return strings.ReplaceAll(strings.TrimLeft(name, "/"), "/", "-")
+}
+
+// Switch to the campaign branch, creating it from HEAD if needed. Uncommitted changes in the worktree are kept
+func checkoutLocalBranch(repoName string, repo *git.Repository) error {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branchName)
+	_, err = repo.Reference(branchRef, false)
+	if err == nil {
+		fmt.Printf("%s: Switching to existing branch %s\n", repoName, branchName)
+		return wt.Checkout(&git.CheckoutOptions{
+			Branch: branchRef,
+			Keep:   true,
+		})
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error getting HEAD: %w", err)
+	}
+	fmt.Printf("%s: Creating new branch\n", repoName)
+	return wt.Checkout(&git.CheckoutOptions{
+		Hash:   head.Hash(),
+		Branch: branchRef,
+		Create: true,
+		Keep:   true,
+	})
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,7 +12,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/spf13/cobra"
 )
@@ -21,6 +25,15 @@ var (
 	branchName     string
 	org            string
 	script         string
+	patchFile      string
+	patchFuzz      int
+	patchThreeWay  bool
+	exportFormats  []string
+	local          bool
+	perDirGlob     string
+	verifyCommand  string
+	env            []string
+	secretEnv      []string
 	makePr         bool
 	title          string
 	description    string
@@ -35,7 +48,6 @@ var (
 	authToken string
 
 	// constants
-	skipExitCode   = 10
 	homeDir        string
 	gitAuthor      string
 	gitAuthorEmail string
@@ -52,82 +64,207 @@ func init() {
 	workspace = filepath.Join(homeDir, "repository-mapper")
 
 	rootCmd.Flags().StringVarP(&branchName, "branch-name", "b", "", "The branch to create. Should be globally unique.")
-	rootCmd.MarkFlagRequired("branch-name")
+	rootCmd.Flags().StringVarP(&org, "org", "o", "", "The github organization the repos live in, unless qualified as org/repo.")
+	rootCmd.Flags().BoolVar(&local, "local", false, "(optional) Treat repos as paths to existing local git repositories instead of cloning them")
+	rootCmd.MarkFlagsMutuallyExclusive("local", "org")
 
-	rootCmd.Flags().StringVarP(&org, "org", "o", "", "The github organization the repos live in.")
-	rootCmd.MarkFlagRequired("org")
-
-	rootCmd.Flags().StringVarP(&script, "script", "s", "", "Path to the script to run in each repository")
-	rootCmd.MarkFlagRequired("script")
+	addChangeFlags(rootCmd)
 
 	rootCmd.Flags().BoolVarP(&makePr, "make-pr", "p", false, "Create a PR in each repo after running the script")
 	rootCmd.Flags().StringVarP(&title, "title", "t", "", "Title of the PR")
 	rootCmd.Flags().StringVarP(&description, "description", "d", "", "Description of the PR")
+	addOutputFlags(rootCmd)
+	rootCmd.Flags().BoolVar(&noTui, "no-tui", false, "(optional) Show plain line logs instead of the live progress view when stdout is a terminal")
+	rootCmd.Flags().BoolVar(&interactive, "interactive", false, "(optional) Review each change and decide whether to push it before opening the PR, requires --make-pr")
 	rootCmd.Flags().StringVar(&defaultBranch, "default-branch", "master", "(optional) Default branch to checkout when cloning/fetching, defaults to master")
 
+	rootCmd.Flags().StringSliceVar(&exportFormats, "export", nil, "(optional) Commit locally and export the changes to ./results instead of pushing, as 'mbox', 'bundle' or both")
+	rootCmd.MarkFlagsMutuallyExclusive("make-pr", "export")
+	rootCmd.MarkFlagsMutuallyExclusive("make-pr", "local")
+	rootCmd.MarkFlagsMutuallyExclusive("export", "local")
+
+	rootCmd.Flags().StringVar(&wavesSpec, "waves", "", "(optional) Open PRs in waves, e.g. '5,25,100%', each a total number or percentage of repos. Only the first wave is opened, run 'continue' for the next")
+	rootCmd.Flags().IntVar(&maxPrs, "max-prs", 0, "(optional) Open at most this many PRs per wave, run 'continue' for the next wave")
+	rootCmd.MarkFlagsMutuallyExclusive("waves", "max-prs")
+
+	addRepoSourceFlags(rootCmd)
+	addAuthFlags(rootCmd)
+}
+
+// Register the flags describing how each repo is changed and checked, shared by every command which runs the script
+func addChangeFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&script, "script", "s", "", "Path to the script to run in each repository")
+	cmd.Flags().StringVar(&patchFile, "patch", "", "Path to a unified diff to apply in each repository instead of running a script")
+	cmd.Flags().IntVar(&patchFuzz, "patch-fuzz", 0, "(optional) Number of context lines which may be ignored when applying --patch")
+	cmd.Flags().BoolVar(&patchThreeWay, "patch-3way", false, "(optional) Fall back to a 3-way merge when --patch does not apply cleanly")
+	cmd.MarkFlagsMutuallyExclusive("script", "patch")
+	cmd.Flags().StringVar(&perDirGlob, "per-dir", "", "(optional) Run the script in every sub-directory containing a file matching this glob, e.g. '**/go.mod'")
+	cmd.MarkFlagsMutuallyExclusive("patch", "per-dir")
+	cmd.Flags().StringVar(&verifyCommand, "verify", "", "(optional) Command which must succeed after the script before changes are committed, e.g. 'go build ./... && go test ./...'")
+
+	addExitCodesFlag(cmd)
+	addTranscriptFlags(cmd)
+	addEnvFlags(cmd)
+	addSecretScanFlags(cmd)
+	addConfigFlag(cmd)
+}
+
+// Register the flags setting environment variables for the script
+func addEnvFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&env, "env", nil, "(optional) KEY=VALUE environment variable to set for the script, can be repeated")
+	cmd.Flags().StringArrayVar(&secretEnv, "secret-env", nil, "(optional) Like --env, but the value is redacted from transcripts, can be repeated")
+}
+
+// Register the flags used to authenticate with github, shared by every command which clones or pushes
+func addAuthFlags(cmd *cobra.Command) {
 	defaultRSAKeyFile := filepath.Join(homeDir, ".ssh", "id_rsa")
-	rootCmd.Flags().StringVar(&rsaKeyFile, "rsa-key-file", defaultRSAKeyFile, "(optional) The location of an rsa key with github permissions, works only with linux and windows")
-	rootCmd.Flags().StringVar(&rsaKeyPassword, "rsa-key-password", "", "(optional) The password for your ssh key if you have one configured, works only with linux and windows")
+	cmd.Flags().StringVar(&rsaKeyFile, "rsa-key-file", defaultRSAKeyFile, "(optional) The location of an rsa key with github permissions, works only with linux and windows")
+	cmd.Flags().StringVar(&rsaKeyPassword, "rsa-key-password", "", "(optional) The password for your ssh key if you have one configured, works only with linux and windows")
 
-	rootCmd.Flags().StringVar(&userName, "user-name", "", "Github user name")
-	rootCmd.Flags().StringVar(&authToken, "auth-token", "", "Github auth token")
+	cmd.Flags().StringVar(&userName, "user-name", "", "Github user name")
+	cmd.Flags().StringVar(&authToken, "auth-token", "", "Github auth token")
 }
 
 var rootCmd = &cobra.Command{
 	Use:          "repository-mapper",
 	Short:        "Run scripts on repositories across your org",
 	Long:         `Run scripts and queries on repositories across your org`,
-	Args:         cobra.MinimumNArgs(1),
+	Args:         cobra.ArbitraryArgs,
 	RunE:         run,
 	SilenceUsage: true,
+	// Inherited by every subcommand, so every results file describes the invocation which wrote it
+	PersistentPreRunE: preRun,
 }
 
 // The main command logic
 func run(cmd *cobra.Command, args []string) error {
-	err := validateArgs()
+	args, err := resolveRepos(args, true)
+	if err != nil {
+		return err
+	}
+	err = validateArgs()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Using script: %s\n", script)
+	switch {
+	case patchFile != "":
+		fmt.Printf("Using patch: %s\n", patchFile)
+	case script == "":
+		fmt.Printf("Using pipeline: %s\n", configFile)
+	default:
+		fmt.Printf("Using script: %s\n", script)
+	}
+
+	var allResults map[string]*runResults
+	var ro *rollout
+	if wavesSpec != "" || maxPrs > 0 {
+		// Only open the first wave of PRs, continue opens the rest
+		ro, err = newRollout(args)
+		if err != nil {
+			return err
+		}
+		allResults = map[string]*runResults{}
+		ro.runWave(allResults)
+	} else {
+		allResults, _ = runRepos(args, -1)
+	}
+
+	// Print out summary of all repo results
+	summarizeResults(allResults)
+
+	// Save detailed result print out to disk
+	err = saveResults(allResults)
+	if err != nil {
+		return fmt.Errorf("error saving results: %s\n", err)
+	}
+	if ro != nil {
+		err = ro.save()
+		if err != nil {
+			return err
+		}
+	}
+	return checkFailures(allResults)
+}
 
+// Run each repo in turn, stopping once maxPrs pull requests have been opened (-1 for no limit).
+// Returns the results and the repos which weren't run
+func runRepos(repoNames []string, maxPrs int) (map[string]*runResults, []string) {
 	allResults := map[string]*runResults{}
+	opened := 0
+
+	err := startProgress(len(repoNames))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error starting progress view, falling back to plain logs: %s\n", err)
+	}
+	defer stopProgress()
 
 	// Run each repo in serial
 	// Could pretty easily allow running in parallel if we wanted to
-	for _, repoName := range args {
+	for i, repoName := range repoNames {
+		if maxPrs >= 0 && opened >= maxPrs {
+			return allResults, repoNames[i:]
+		}
 		// Defer to the per-repo operations (i.e. cloning, git-ops, running script)
-		results, err := runRepo(repoName)
+		progressName := repoName
+		if local {
+			progressName = localRepoName(repoName)
+		}
+		progress.startRepo(progressName)
+		var results *runResults
+		var err error
+		if local {
+			results, err = runLocalRepo(repoName)
+		} else {
+			results, err = runRepo(repoName)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %s\n", repoName, err)
+			recordError(repoName, err)
+			progress.finishRepo(progressName, nil, err)
 			continue
 		}
+		results.redact(redactCredentials)
+		// Save the results straight away so they survive the run dying part way through
+		recordResults(repoName, results)
 		// Print out the results for this repo
 		logResults(results)
+		progress.finishRepo(progressName, results, nil)
 		// Stash results for summary
 		allResults[repoName] = results
+		if results.PullRequest != "" {
+			opened++
+		}
+		if results.Decision == decisionAborted {
+			fmt.Println("Run aborted, remaining repos were not run")
+			return allResults, repoNames[i+1:]
+		}
 	}
-
-	// Print out summary of all repo results
-	summarizeResults(allResults)
-
-	// Save detailed result print out to disk
-	err = saveResults(allResults)
-	if err != nil {
-		return fmt.Errorf("error saving results: %s\n", err)
-	}
-	return nil
+	return allResults, nil
 }
 
 // Print all the results to console
 func summarizeResults(allResults map[string]*runResults) {
-	var successes, skips, failures []*runResults
+	var successes, skips, failures, warnings, manual, patchFailures, verifyFailures, guardViolations, secretsFound, stale []*runResults
 	for _, result := range allResults {
-		switch result.ExitCode {
-		case 0:
+		switch result.Outcome {
+		case outcomeSucceeded:
 			successes = append(successes, result)
-		case skipExitCode:
+		case outcomeSkipped:
 			skips = append(skips, result)
+		case outcomeWarned:
+			warnings = append(warnings, result)
+		case outcomeManual:
+			manual = append(manual, result)
+		case outcomePatchFailed:
+			patchFailures = append(patchFailures, result)
+		case outcomeVerifyFailed:
+			verifyFailures = append(verifyFailures, result)
+		case outcomeGuardViolation:
+			guardViolations = append(guardViolations, result)
+		case outcomeSecretsFound:
+			secretsFound = append(secretsFound, result)
+		case outcomeStale:
+			stale = append(stale, result)
 		default:
 			failures = append(failures, result)
 		}
@@ -152,36 +289,191 @@ func summarizeResults(allResults map[string]*runResults) {
 	for _, r := range failures {
 		fmt.Println(r.Repo)
 	}
+
+	// Outcomes only some campaigns can have are only shown when they occurred
+	printOptionalSection("⚠️  SUCCEEDED WITH WARNINGS ⚠️ ", warnings)
+	printOptionalSection("✋ NEEDS MANUAL FOLLOW-UP ✋", manual)
+	printOptionalSection("🩹 DID NOT APPLY 🩹", patchFailures)
+	printOptionalSection("🔍 VERIFY FAILED 🔍", verifyFailures)
+	printOptionalSection("🛑 GUARD VIOLATION 🛑", guardViolations)
+	printOptionalSection("🔑 SECRETS FOUND 🔑", secretsFound)
+	printOptionalSection("🕰  STALE PLAN 🕰 ", stale)
+	// Group failures by their error so each class of failure can be dealt with at once
+	printTriage(allResults, repoErrors)
 	// spacer
 	fmt.Println("")
 }
 
+// Print a section of the summary, only if it has any repos
+func printOptionalSection(heading string, results []*runResults) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("\n===============")
+	fmt.Println(heading)
+	fmt.Println("===============")
+	for _, r := range results {
+		if r.PullRequest != "" {
+			fmt.Printf("%s %s\n", r.Repo, r.PullRequest)
+		} else {
+			fmt.Println(r.Repo)
+		}
+	}
+}
+
+// Name used for the results of the current branch, safe for use as a file name
+func resultsName() string {
+	if branchName == "" {
+		// Only possible in --local mode
+		return "local"
+	}
+	return strings.ReplaceAll(branchName, "/", "-")
+}
+
+// Path of the results file for the current branch, always holding the latest results of every repo
+func resultsPath() string {
+	return filepath.Join(".", "results", resultsName()+".json")
+}
+
+// Save the results of the run, both to a results file for this run and to the latest results for the branch.
+// The results and errors of this run are read back from its log, and take precedence over those passed in which may
+// include repos from earlier runs
 func saveResults(allResults map[string]*runResults) error {
-	// Ensure results dir exists
-	os.MkdirAll("./results", os.ModePerm)
-	fp := filepath.Join(".", "results", strings.ReplaceAll(branchName, "/", "-")+".json")
-	data, err := json.Marshal(allResults)
+	// Ensure results dir exists, transcripts may contain sensitive output so only the current user can read them
+	os.MkdirAll("./results", 0700)
+	logged, err := closeResultsLog()
 	if err != nil {
-		return err
+		return fmt.Errorf("error reading results log: %w", err)
+	}
+	if logged != nil {
+		for repoName, r := range logged.Repos {
+			allResults[repoName] = r
+		}
+		for repoName, message := range logged.Errors {
+			repoErrors[repoName] = message
+		}
 	}
-	err = os.WriteFile(fp, data, os.ModePerm)
+	data, err := json.Marshal(&resultsFile{Run: finishRunHeader(), Repos: allResults, Errors: repoErrors})
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Job results (and stdout/stderr transcripts) available in ./%s\n", fp)
+
+	// Every run keeps its own results, so earlier runs aren't lost when the latest results are replaced
+	runFp := runResultsPath(".json")
+	fp := resultsPath()
+	for _, p := range []string{runFp, fp} {
+		err = os.WriteFile(p, data, 0600)
+		if err != nil {
+			return err
+		}
+		// WriteFile keeps the permissions of an existing file, which older versions created world-readable
+		err = os.Chmod(p, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Job results (and stdout/stderr transcripts) available in ./%s, and for this run in ./%s\n", fp, runFp)
+	if outputFormat == outputJson {
+		_, err = resultsOut.Write(append(data, '\n'))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Read the results of each repo from a results file written by a previous run
+func loadResults(fp string) (map[string]*runResults, error) {
+	f, err := loadResultsFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	return f.Repos, nil
+}
+
+// Read a results file written by a previous run, including its header. Results logs (.jsonl) are read too
+func loadResultsFile(fp string) (*resultsFile, error) {
+	f, err := readResultsFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range f.Repos {
+		if r.Outcome == "" {
+			// Older versions didn't record an outcome, only the exit code it came from
+			r.Outcome = outcomeForExitCode(r.ExitCode)
+		}
+	}
+	return f, nil
+}
+
+func readResultsFile(fp string) (*resultsFile, error) {
+	if strings.HasSuffix(fp, ".jsonl") {
+		return loadResultsLog(fp)
+	}
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	f := &resultsFile{}
+	err = json.Unmarshal(data, f)
+	if err == nil && f.Repos == nil {
+		// Older versions wrote just the results of each repo, without a header
+		f.Run = &runHeader{}
+		err = json.Unmarshal(data, &f.Repos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fp, err)
+	}
+	return f, nil
+}
+
 // Log results from a single repo run
 func logResults(r *runResults) {
-	switch r.ExitCode {
-	case 0:
+	switch r.Outcome {
+	case outcomeSucceeded:
 		fmt.Printf("%s: ✅ SUCCESS\n", r.Repo)
 		if r.PullRequest != "" {
 			fmt.Printf("%s: Pull Request: %s\n", r.Repo, r.PullRequest)
 		}
-	case skipExitCode:
+	case outcomeSkipped:
 		fmt.Printf("%s: ⏭  SKIPPED\n", r.Repo)
+	case outcomeWarned, outcomeManual:
+		if r.Outcome == outcomeWarned {
+			fmt.Printf("%s: ⚠️  SUCCEEDED WITH WARNINGS, exited with %d\n", r.Repo, r.ExitCode)
+		} else {
+			fmt.Printf("%s: ✋ NEEDS MANUAL FOLLOW-UP, exited with %d\n", r.Repo, r.ExitCode)
+		}
+		errLines := strings.Split(r.Stderr, "\n")
+		if errLines[0] != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s...\n", r.Repo, errLines[0])
+		}
+		if r.PullRequest != "" {
+			fmt.Printf("%s: Pull Request: %s\n", r.Repo, r.PullRequest)
+		}
+	case outcomePatchFailed:
+		fmt.Printf("%s: 🩹 PATCH DID NOT APPLY\n", r.Repo)
+		errLines := strings.Split(r.Stderr, "\n")
+		if errLines[0] != "" {
+			fmt.Fprintf(os.Stderr, "%s: Error: %s...\n", r.Repo, errLines[0])
+		}
+	case outcomeVerifyFailed:
+		fmt.Printf("%s: 🔍 VERIFY FAILED, exited with %d\n", r.Repo, r.Verify.ExitCode)
+		errLines := strings.Split(r.Verify.Stderr, "\n")
+		if errLines[0] != "" {
+			fmt.Fprintf(os.Stderr, "%s: Error: %s...\n", r.Repo, errLines[0])
+		}
+	case outcomeGuardViolation:
+		fmt.Printf("%s: 🛑 GUARD VIOLATION\n", r.Repo)
+		for _, violation := range r.GuardViolations {
+			fmt.Fprintf(os.Stderr, "%s: Violation: %s\n", r.Repo, violation)
+		}
+	case outcomeStale:
+		fmt.Printf("%s: 🕰  STALE PLAN, %s moved since planning\n", r.Repo, defaultBranch)
+	case outcomeSecretsFound:
+		fmt.Printf("%s: 🔑 SECRETS FOUND\n", r.Repo)
+		for _, f := range r.SecretFindings {
+			fmt.Fprintf(os.Stderr, "%s: Possible %s at %s:%d: %s\n", r.Repo, f.Rule, f.Path, f.Line, f.Redacted)
+		}
 	default:
 		fmt.Printf("%s: 🚨 FAILED, exited with %d\n", r.Repo, r.ExitCode)
 		errLines := strings.Split(r.Stderr, "\n")
@@ -191,69 +483,246 @@ func logResults(r *runResults) {
 	}
 }
 
+// Outcomes of a single repo run
+const (
+	outcomeSucceeded   = "succeeded"
+	outcomeSkipped     = "skipped"
+	outcomeFailed      = "failed"
+	outcomePatchFailed = "patch_failed"
+	// The script exited with a --exit-codes 'warn' code, the change is still pushed
+	outcomeWarned = "warned"
+	// The script exited with a --exit-codes 'manual' code, the change is pushed but needs finishing by hand
+	outcomeManual = "manual"
+	// The change was made but the --verify command failed, so nothing was committed
+	outcomeVerifyFailed = "verify_failed"
+	// The change broke one of the config's guards, so nothing was committed
+	outcomeGuardViolation = "guard_violation"
+	// Secrets were found in the change, so nothing was committed
+	outcomeSecretsFound = "secrets_found"
+	// The default branch moved since the change was planned, so the planned change wasn't applied
+	outcomeStale = "stale"
+)
+
 // Results from a single repo run
 type runResults struct {
-	Repo        string `json:"repo"`
-	Stdout      string `json:"stdout"`
-	Stderr      string `json:"stderr"`
-	ExitCode    int    `json:"exitCode"`
-	PullRequest string `json:"pullRequest"`
+	Repo       string `json:"repo"`
+	Path       string `json:"path,omitempty"`
+	Script     string `json:"script,omitempty"`
+	Patch      string `json:"patch,omitempty"`
+	PerDir     string `json:"perDir,omitempty"`
+	BaseCommit string `json:"baseCommit,omitempty"`
+	// How the patch was applied, only set with --patch
+	PatchFuzz     int  `json:"patchFuzz,omitempty"`
+	PatchThreeWay bool `json:"patchThreeWay,omitempty"`
+	// Commit the branch ended up on, only set if anything was committed
+	ResultCommit string   `json:"resultCommit,omitempty"`
+	Stdout       string   `json:"stdout"`
+	Stderr       string   `json:"stderr"`
+	ExitCode     int      `json:"exitCode"`
+	Outcome      string   `json:"outcome"`
+	PullRequest  string   `json:"pullRequest"`
+	Exports      []string `json:"exports,omitempty"`
+	// Results for each sub-directory the script ran in, only set with --per-dir
+	Dirs []*dirResults `json:"dirs,omitempty"`
+	// Results for each step of the pipeline, only set when the config defines one
+	Steps []*stepResults `json:"steps,omitempty"`
+	// Results of the --verify command, only set if it was run
+	Verify *verifyResults `json:"verify,omitempty"`
+	// Reasons the change was blocked by the config's guards
+	GuardViolations []string `json:"guardViolations,omitempty"`
+	// Possible secrets found in the change, redacted
+	SecretFindings []*secretFinding `json:"secretFindings,omitempty"`
+	// Whether the change was approved when reviewed with --interactive
+	Decision string `json:"decision,omitempty"`
+	// Title of the PR, also the commit message unless it was edited during review
+	Title string `json:"title,omitempty"`
+	// Commit message edited during review, the title is used otherwise
+	CommitMessage string `json:"commitMessage,omitempty"`
+	// Timing of each phase of the run, in the order they ran
+	Phases []*phaseTiming `json:"phases,omitempty"`
 }
 
 // Perform all necessary tasks for a single repo
 func runRepo(repoName string) (*runResults, error) {
+	repoPath, repo, phases, err := prepareRepo(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := runInRepo(repoName, repoPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	r.Phases = append(phases, r.Phases...)
+	return r, nil
+}
+
+// Clone (or fetch) a repo into the workspace and check out the campaign branch from its latest default branch,
+// returning the timing of both phases
+func prepareRepo(repoName string) (string, *git.Repository, []*phaseTiming, error) {
 	repoPath := filepath.Join(workspace, repoName)
+	start := startPhase(repoName, phaseClone)
 	repo, err := checkoutRepo(repoName, repoPath, defaultBranch)
 	if err != nil {
-		return nil, err
+		return "", nil, nil, err
 	}
+	clone := endPhase(phaseClone, start)
 
 	// Checkout the desired branch name tracking from latest default
+	start = startPhase(repoName, phaseCheckout)
 	err = checkoutBranch(repoName, repo, defaultBranch)
 	if err != nil {
-		return nil, err
+		return "", nil, nil, err
 	}
+	return repoPath, repo, []*phaseTiming{clone, endPhase(phaseCheckout, start)}, nil
+}
 
-	// Run the script inside the repo
-	stdout, stderr, exitCode, err := runScriptInRepo(repoName, repoPath)
+// Make the change in a checked out repo, then open a PR or export the changes as requested
+func runInRepo(repoName string, repoPath string, repo *git.Repository) (*runResults, error) {
+	r, base, err := changeAndCheckRepo(repoName, repoPath, repo)
 	if err != nil {
 		return nil, err
 	}
 
-	var prURL string
-	// Only make a PR if the script succeeded and the flag is set
-	if makePr && exitCode == 0 {
-		prURL, err = makePullRequest(repoName, repoPath, repo)
+	// Let the user review the change before anything is pushed
+	if interactive && makePr && outcomeAllowsPr(r.Outcome) {
+		err = reviewChange(repoName, repoPath, r)
+		if err != nil {
+			return nil, err
+		}
+		if r.Decision != decisionApproved && outcomeAllowsPr(r.Outcome) {
+			r.Outcome = outcomeSkipped
+		}
+	}
+
+	// Only make a PR if the script succeeded (or exited with a code which still allows one) and the flag is set
+	if makePr && outcomeAllowsPr(r.Outcome) {
+		err = makePullRequest(repoName, repoPath, repo, base, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Export instead of pushing if the script succeeded and the flag is set
+	if len(exportFormats) > 0 && outcomeAllowsPr(r.Outcome) {
+		start := startPhase(repoName, phaseCommit)
+		r.Exports, err = exportChanges(repoName, repoPath, repo, base)
 		if err != nil {
 			return nil, err
 		}
+		if len(r.Exports) > 0 {
+			r.addPhase(phaseCommit, start)
+			r.setResultCommit(repo)
+		}
+	}
+	return r, nil
+}
+
+// Make the change in a checked out repo and check it, returning the results and the commit the change was made on
+func changeAndCheckRepo(repoName string, repoPath string, repo *git.Repository) (*runResults, plumbing.Hash, error) {
+	// Remember where the branch started so commits made by the script can be found
+	base, err := repo.Head()
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("error getting HEAD: %w", err)
+	}
+
+	// Run the script (or apply the patch) inside the repo
+	start := startPhase(repoName, phaseScript)
+	r, err := changeRepo(repoName, repoPath)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	r.addPhase(phaseScript, start)
+	r.BaseCommit = base.Hash().String()
+
+	start = startPhase(repoName, phaseChecks)
+	err = checkRepo(repoName, repoPath, r)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
 	}
+	r.addPhase(phaseChecks, start)
+	return r, base.Hash(), nil
+}
 
+// Run every check a successful change must pass before it is committed.
+// Each check is skipped once an earlier one has changed the outcome
+func checkRepo(repoName, repoPath string, r *runResults) error {
+	err := verifyRepo(repoName, repoPath, r)
+	if err != nil {
+		return err
+	}
+	err = guardRepo(repoName, repoPath, r)
+	if err != nil {
+		return err
+	}
+	return scanRepo(repoName, repoPath, r)
+}
+
+// Make the campaign's change in the repo, either by applying the patch or running the script
+func changeRepo(repoName, repoPath string) (*runResults, error) {
+	err := resetTranscripts(repoName)
+	if err != nil {
+		return nil, fmt.Errorf("error removing old transcripts: %w", err)
+	}
 	r := &runResults{
-		Repo:        repoName,
-		ExitCode:    exitCode,
-		Stdout:      string(stdout),
-		Stderr:      string(stderr),
-		PullRequest: prURL,
+		Repo:   repoName,
+		Script: script,
+		Patch:  patchFile,
+		PerDir: perDirGlob,
+		Title:  title,
+	}
+	var stdout, stderr []byte
+	switch {
+	case patchFile != "":
+		r.PatchFuzz, r.PatchThreeWay = patchFuzz, patchThreeWay
+		stdout, stderr, r.ExitCode, r.Outcome, err = applyPatchInRepo(repoName, repoPath)
+	case script == "":
+		r.Steps, r.ExitCode, err = runPipelineInRepo(repoName, repoPath)
+		if err != nil {
+			return nil, err
+		}
+		stderr = pipelineStderr(r.Steps)
+		r.Outcome = outcomeForExitCode(r.ExitCode)
+	case perDirGlob != "":
+		r.Dirs, err = runScriptPerDir(repoName, repoPath)
+		if err != nil {
+			return nil, err
+		}
+		r.ExitCode, r.Outcome, stderr = combineDirResults(r.Dirs)
+	default:
+		stdout, stderr, r.ExitCode, err = runScriptInRepo(repoName, repoPath)
+		r.Outcome = outcomeForExitCode(r.ExitCode)
+	}
+	if err != nil {
+		return nil, err
 	}
+	r.Stdout = string(stdout)
+	r.Stderr = string(stderr)
 	return r, nil
 }
 
 func runScriptInRepo(repoName, repoPath string) (stdoutBytes []byte, stderrBytes []byte, exitCode int, err error) {
-	scriptCmd := exec.Command(script)
-	scriptCmd.Dir = repoPath
-	stdout := &bytes.Buffer{}
-	stderr := &bytes.Buffer{}
-	scriptCmd.Stdout = stdout
-	scriptCmd.Stderr = stderr
-
 	fmt.Printf("%s: 🏃‍♂️ Running script\n", repoName)
-	// Run synchronously, can probably switch to async later
-	err = scriptCmd.Run()
-	// err is returned on non-zero script exit codes, so we check specifically for something OTHER than an ExitError
-	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+	stdoutBytes, stderrBytes, exitCode, err = runTranscribedCommand(context.Background(), repoName, "script", repoPath, script)
+	if err != nil {
 		return nil, nil, 0, fmt.Errorf("error running script: %w", err)
 	}
+	return stdoutBytes, stderrBytes, exitCode, nil
+}
+
+// Run a command in dir and collect its output. A non-zero exit code is reported rather than returned as an error
+func runCommand(dir string, name string, args ...string) (stdoutBytes []byte, stderrBytes []byte, exitCode int, err error) {
+	return runCommandContext(context.Background(), dir, name, args...)
+}
+
+// Like runCommand, but the command is killed when ctx is done. A killed command reports an exit code of -1
+func runCommandContext(ctx context.Context, dir string, name string, args ...string) (stdoutBytes []byte, stderrBytes []byte, exitCode int, err error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode, err = runCommandWriters(ctx, dir, stdout, stderr, name, args...)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 
 	stdoutBytes, err = io.ReadAll(stdout)
 	if err != nil {
@@ -263,7 +732,31 @@ func runScriptInRepo(repoName, repoPath string) (stdoutBytes []byte, stderrBytes
 	if err != nil {
 		return nil, nil, 0, err
 	}
-	return stdoutBytes, stderrBytes, scriptCmd.ProcessState.ExitCode(), nil
+	return stdoutBytes, stderrBytes, exitCode, nil
+}
+
+// Like runCommandContext, but the output is written to stdout and stderr as the command runs
+func runCommandWriters(ctx context.Context, dir string, stdout, stderr io.Writer, name string, args ...string) (exitCode int, err error) {
+	c := exec.CommandContext(ctx, name, args...)
+	c.Dir = dir
+	c.Env = append(append(os.Environ(), env...), secretEnv...)
+	// Commands which can time out are killed along with everything they started
+	if ctx.Done() != nil {
+		killProcessGroupOnCancel(c)
+	}
+	// Don't wait forever on output from any children left behind by a killed command
+	c.WaitDelay = 5 * time.Second
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	// Run synchronously, can probably switch to async later
+	err = c.Run()
+	// err is returned on non-zero exit codes, so we check specifically for something OTHER than an ExitError.
+	// Errors caused by ctx being done are left for the caller to check with ctx.Err()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok && ctx.Err() == nil {
+		return 0, err
+	}
+	return c.ProcessState.ExitCode(), nil
 }
 
 func Execute() {
@@ -273,15 +766,61 @@ func Execute() {
 }
 
 func validateArgs() error {
-	_, err := os.Stat(script)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("Could not find script: '%s'", script)
-	}
-	script, err = filepath.Abs(script)
+	err := loadRunSettings()
 	if err != nil {
 		return err
 	}
 
+	if patchFile != "" {
+		patchFile, err = validatePatchArgs()
+		if err != nil {
+			return err
+		}
+	} else if script == "" {
+		if len(cfg.Pipeline) == 0 {
+			return fmt.Errorf("A script, patch or pipeline is required. Pass one with -s, --patch or --config")
+		}
+		if perDirGlob != "" {
+			return fmt.Errorf("--per-dir can't be used with a pipeline")
+		}
+	} else {
+		_, err = os.Stat(script)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("Could not find script: '%s'", script)
+		}
+		script, err = filepath.Abs(script)
+		if err != nil {
+			return err
+		}
+	}
+	if perDirGlob != "" {
+		err = validateGlob(perDirGlob)
+		if err != nil {
+			return fmt.Errorf("Invalid --per-dir glob '%s': %w", perDirGlob, err)
+		}
+	}
+
+	if wavesSpec != "" || maxPrs != 0 {
+		err = validateRolloutArgs()
+		if err != nil {
+			return err
+		}
+	}
+	if interactive {
+		err = validateInteractiveArgs()
+		if err != nil {
+			return err
+		}
+	}
+
+	if local {
+		// Nothing is cloned or pushed, so neither an org nor auth are needed
+		return validateLocalArgs()
+	}
+	if branchName == "" {
+		return fmt.Errorf("A branch name is required. Pass one with -b")
+	}
+
 	err = initAuth()
 	if err != nil {
 		return err
@@ -298,21 +837,77 @@ func validateArgs() error {
 		if description == "" {
 			return fmt.Errorf("A PR description is required. Pass one with -d")
 		}
-		getAuthorCmd := exec.Command("git", "config", "user.name")
-		authorBytes, err := getAuthorCmd.Output()
-		gitAuthor = strings.TrimSpace(string(authorBytes))
-		if err != nil || gitAuthor == "" {
-			gitAuthor = "Unknown"
+		err = initGitAuthor()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(exportFormats) > 0 {
+		err = validateExportArgs()
+		if err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		getAuthorEmailCmd := exec.Command("git", "config", "user.email")
-		authorEmailBytes, err := getAuthorEmailCmd.Output()
-		gitAuthorEmail = strings.TrimSpace(string(authorEmailBytes))
-		if err != nil || gitAuthorEmail == "" {
-			return fmt.Errorf("Error getting author email: %s", err)
+// Load and check the settings shared by every command which runs a campaign's change
+func loadRunSettings() error {
+	err := loadConfig()
+	if err != nil {
+		return err
+	}
+	err = parseExitCodes()
+	if err != nil {
+		return err
+	}
+	err = loadSecretAllowlist()
+	if err != nil {
+		return err
+	}
+	err = validateEnv()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Set up auth and the commit author for commands which push to existing campaign branches
+func initPushing() error {
+	err := initAuth()
+	if err != nil {
+		return err
+	}
+	return initGitAuthor()
+}
+
+// Check every --env and --secret-env is of the form KEY=VALUE
+func validateEnv() error {
+	for _, kv := range append(append([]string{}, env...), secretEnv...) {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("Invalid environment variable '%s', expected KEY=VALUE", kv)
 		}
 	}
+	return nil
+}
 
+// Read the commit author from the local git config
+func initGitAuthor() error {
+	getAuthorCmd := exec.Command("git", "config", "user.name")
+	authorBytes, err := getAuthorCmd.Output()
+	gitAuthor = strings.TrimSpace(string(authorBytes))
+	if err != nil || gitAuthor == "" {
+		gitAuthor = "Unknown"
+	}
+
+	getAuthorEmailCmd := exec.Command("git", "config", "user.email")
+	authorEmailBytes, err := getAuthorEmailCmd.Output()
+	gitAuthorEmail = strings.TrimSpace(string(authorEmailBytes))
+	if err != nil || gitAuthorEmail == "" {
+		return fmt.Errorf("Error getting author email: %s", err)
+	}
 	return nil
 }
 
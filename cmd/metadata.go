@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Phases of a single repo run
+const (
+	phaseClone    = "clone"
+	phaseCheckout = "checkout"
+	phaseFetch    = "fetch"
+	phaseScript   = "script"
+	phaseChecks   = "checks"
+	phaseCommit   = "commit"
+	phasePush     = "push"
+	phasePr       = "pr"
+)
+
+// When a phase of a repo run started and ended
+type phaseTiming struct {
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Describes the invocation which wrote a results file
+type runHeader struct {
+	Version    string    `json:"version"`
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Script     string    `json:"script,omitempty"`
+	// Hex SHA-256 of the script's contents when the run finished
+	ScriptSha256 string `json:"scriptSha256,omitempty"`
+	Patch        string `json:"patch,omitempty"`
+	PatchSha256  string `json:"patchSha256,omitempty"`
+	// Every flag which was set, with credentials redacted
+	Flags map[string]string `json:"flags"`
+	Host  string            `json:"host"`
+	User  string            `json:"user"`
+}
+
+// Contents of a results file
+type resultsFile struct {
+	Run   *runHeader             `json:"run"`
+	Repos map[string]*runResults `json:"repos"`
+	// Errors which stopped repos from running, keyed like repos
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Flags whose values are never written to results
+var sensitiveFlags = map[string]bool{
+	"auth-token":       true,
+	"rsa-key-password": true,
+	"secret-env":       true,
+}
+
+// Header of the current invocation, started before any command runs
+var header = &runHeader{}
+
+// Set up the current invocation before any command runs
+func preRun(cmd *cobra.Command, args []string) error {
+	startRunHeader(cmd, args)
+	return startOutput()
+}
+
+// Start the header of the current invocation
+func startRunHeader(cmd *cobra.Command, _ []string) {
+	h := &runHeader{
+		Version:   Version,
+		Command:   cmd.CommandPath(),
+		StartedAt: time.Now().UTC(),
+		Flags:     map[string]string{},
+	}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if sensitiveFlags[f.Name] {
+			h.Flags[f.Name] = redacted
+		} else {
+			h.Flags[f.Name] = redactCredentials(f.Value.String())
+		}
+	})
+	h.Host, _ = os.Hostname()
+	if usr, err := user.Current(); err == nil {
+		h.User = usr.Username
+	}
+	header = h
+}
+
+// Finish the header of the current invocation, recording the script and patch as they were used
+func finishRunHeader() *runHeader {
+	now := time.Now().UTC()
+	header.FinishedAt = now
+	header.DurationMs = now.Sub(header.StartedAt).Milliseconds()
+	header.Script = script
+	header.ScriptSha256 = fileSha256(script)
+	header.Patch = patchFile
+	header.PatchSha256 = fileSha256(patchFile)
+	return header
+}
+
+// Hex SHA-256 of a file's contents, empty if it can't be read
+func fileSha256(fp string) string {
+	if fp == "" {
+		return ""
+	}
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Note the start of a phase of a repo run, returning when it started
+func startPhase(repoName, name string) time.Time {
+	progress.phase(repoName, name)
+	return time.Now()
+}
+
+// Record a phase which started at start and has just ended
+func (r *runResults) addPhase(name string, start time.Time) {
+	r.Phases = append(r.Phases, endPhase(name, start))
+}
+
+// Timing of a phase which started at start and has just ended
+func endPhase(name string, start time.Time) *phaseTiming {
+	end := time.Now()
+	return &phaseTiming{
+		Name:       name,
+		Start:      start.UTC(),
+		End:        end.UTC(),
+		DurationMs: end.Sub(start).Milliseconds(),
+	}
+}
+
+// Record the commit the branch ended up on
+func (r *runResults) setResultCommit(repo *git.Repository) {
+	head, err := repo.Head()
+	if err != nil {
+		return
+	}
+	r.ResultCommit = head.Hash().String()
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Formats of the final output of a run
+const (
+	outputText = "text"
+	outputJson = "json"
+)
+
+var (
+	outputFormat string
+	maxFailures  int
+
+	// Where the results document is printed with --output json, everything else printed goes to stderr
+	resultsOut = os.Stdout
+
+	// Errors which stopped a repo from running in this invocation, keyed like the results
+	repoErrors = map[string]string{}
+)
+
+// Register the flags controlling the final output and exit status of a command
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "output", outputText, "(optional) Format of the final output, 'text' or 'json'. With 'json' the results document is printed to stdout and logs to stderr")
+	addMaxFailuresFlag(cmd)
+}
+
+// Register --max-failures on its own, for commands which don't write a results document
+func addMaxFailuresFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&maxFailures, "max-failures", 0, "(optional) Number of repos which may fail or error before exiting with a non-zero status")
+}
+
+// Set up the output of the current invocation, sending logs to stderr when stdout is kept for the results document
+func startOutput() error {
+	switch outputFormat {
+	case "", outputText:
+	case outputJson:
+		os.Stdout = os.Stderr
+	default:
+		return fmt.Errorf("Unknown --output '%s', expected '%s' or '%s'", outputFormat, outputText, outputJson)
+	}
+	if maxFailures < 0 {
+		return fmt.Errorf("--max-failures must not be negative")
+	}
+	return nil
+}
+
+// Print and remember an error which stopped a repo from running
+func recordError(repoName string, err error) {
+	message := redactCredentials(err.Error())
+	fmt.Fprintf(os.Stderr, "%s: %s\n", repoName, message)
+	repoErrors[repoName] = message
+	logError(repoName, message)
+}
+
+// Whether an outcome counts against --max-failures
+func countsAsFailure(outcome string) bool {
+	return !outcomeAllowsPr(outcome) && outcome != outcomeSkipped
+}
+
+// Annotate the results of this invocation when running in GitHub Actions, then fail if more repos failed or errored
+// than --max-failures allows
+func checkFailures(results map[string]*runResults) error {
+	annotate := os.Getenv("GITHUB_ACTIONS") == "true"
+
+	var repoNames []string
+	for repoName := range results {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	failures := 0
+	for _, repoName := range repoNames {
+		r := results[repoName]
+		switch {
+		case countsAsFailure(r.Outcome):
+			failures++
+			if annotate {
+				printAnnotation("error", r.Repo, outcomeMessage(r))
+			}
+		case r.Outcome == outcomeWarned || r.Outcome == outcomeManual:
+			if annotate {
+				printAnnotation("warning", r.Repo, outcomeMessage(r))
+			}
+		}
+	}
+
+	var errored []string
+	for repoName := range repoErrors {
+		errored = append(errored, repoName)
+	}
+	sort.Strings(errored)
+	for _, repoName := range errored {
+		failures++
+		if annotate {
+			printAnnotation("error", repoName, firstLine(repoErrors[repoName]))
+		}
+	}
+
+	if failures > maxFailures {
+		return fmt.Errorf("%d of %d repos failed or errored, more than --max-failures %d", failures, len(results)+len(repoErrors), maxFailures)
+	}
+	return nil
+}
+
+// Describe the outcome of a repo in a single line, with the first line of its stderr if it had any
+func outcomeMessage(r *runResults) string {
+	message := fmt.Sprintf("%s, exited with %d", r.Outcome, r.ExitCode)
+	if line := firstLine(r.Stderr); line != "" {
+		message += ": " + line
+	}
+	return message
+}
+
+// Print a GitHub Actions workflow command annotating the run with a message about a repo
+func printAnnotation(level, repoName, message string) {
+	fmt.Printf("::%s title=%s::%s\n", level, escapeAnnotation(repoName, true), escapeAnnotation(message, false))
+}
+
+// Escape text for a workflow command, properties also need their separators escaped
+func escapeAnnotation(text string, property bool) string {
+	text = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(text)
+	if property {
+		text = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(text)
+	}
+	return text
+}
+
+// First non-empty line of some output
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
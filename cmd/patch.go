@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The number of context lines git diff produces by default, --patch-fuzz is subtracted from this
+const defaultPatchContext = 3
+
+// Check the patch flags and return the absolute path of the patch file
+func validatePatchArgs() (string, error) {
+	_, err := os.Stat(patchFile)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("Could not find patch: '%s'", patchFile)
+	}
+	if patchFuzz < 0 || patchFuzz > defaultPatchContext {
+		return "", fmt.Errorf("--patch-fuzz must be between 0 and %d", defaultPatchContext)
+	}
+	return filepath.Abs(patchFile)
+}
+
+// Apply the patch to the repo's worktree.
+// A patch which is already present in the repo is skipped, and one which cannot be applied results in outcomePatchFailed
+func applyPatchInRepo(repoName, repoPath string) (stdout []byte, stderr []byte, exitCode int, outcome string, err error) {
+	fmt.Printf("%s: 🩹 Applying patch\n", repoName)
+	applyArgs := []string{"-C" + strconv.Itoa(defaultPatchContext-patchFuzz)}
+
+	checkArgs := append(append([]string{}, applyArgs...), "--check", patchFile)
+	stdout, stderr, exitCode, err = runApplyCommand(repoName, repoPath, checkArgs...)
+	if err != nil {
+		return nil, nil, 0, "", fmt.Errorf("error checking patch: %w", err)
+	}
+	if exitCode == 0 {
+		stdout, stderr, exitCode, err = runApplyCommand(repoName, repoPath, append(applyArgs, patchFile)...)
+		if err != nil {
+			return nil, nil, 0, "", fmt.Errorf("error applying patch: %w", err)
+		}
+		if exitCode != 0 {
+			return stdout, stderr, exitCode, outcomePatchFailed, nil
+		}
+		return stdout, stderr, 0, outcomeSucceeded, nil
+	}
+
+	// If the patch applies in reverse then the change has already been made
+	reverseArgs := append(append([]string{}, applyArgs...), "--check", "--reverse", patchFile)
+	_, _, reverseExitCode, err := runApplyCommand(repoName, repoPath, reverseArgs...)
+	if err != nil {
+		return nil, nil, 0, "", fmt.Errorf("error checking patch: %w", err)
+	}
+	if reverseExitCode == 0 {
+		fmt.Printf("%s: Patch is already applied\n", repoName)
+		return stdout, stderr, defaultSkipExitCode, outcomeSkipped, nil
+	}
+
+	if !patchThreeWay {
+		return stdout, stderr, exitCode, outcomePatchFailed, nil
+	}
+
+	fmt.Printf("%s: Patch does not apply cleanly, falling back to a 3-way merge\n", repoName)
+	stdout, stderr, exitCode, err = runApplyCommand(repoName, repoPath, append(applyArgs, "--3way", patchFile)...)
+	if err != nil {
+		return nil, nil, 0, "", fmt.Errorf("error applying patch: %w", err)
+	}
+	if exitCode != 0 {
+		return stdout, stderr, exitCode, outcomePatchFailed, nil
+	}
+	return stdout, stderr, 0, outcomeSucceeded, nil
+}
+
+// Run git apply with args in the repo, writing its output to the repo's transcripts
+func runApplyCommand(repoName, repoPath string, args ...string) (stdout []byte, stderr []byte, exitCode int, err error) {
+	return runTranscribedCommand(context.Background(), repoName, "git apply "+strings.Join(args, " "), repoPath, "git", append([]string{"apply"}, args...)...)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// Directories which are never searched for --per-dir matches
+var perDirSkipDirs = map[string]bool{
+	".git":         true,
+	"vendor":       true,
+	"node_modules": true,
+}
+
+// Results from running the script in a single sub-directory of a repo
+type dirResults struct {
+	Dir      string `json:"dir"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// Find every directory in the repo containing a file matching the --per-dir glob, relative to the repo root
+func findPerDirs(repoPath string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	err := filepath.WalkDir(repoPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != repoPath && perDirSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(repoPath, p)
+		if err != nil {
+			return err
+		}
+		if !matchGlob(perDirGlob, filepath.ToSlash(rel)) {
+			return nil
+		}
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// Run the script in every directory matching the --per-dir glob
+func runScriptPerDir(repoName, repoPath string) ([]*dirResults, error) {
+	dirs, err := findPerDirs(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("error finding directories: %w", err)
+	}
+	if len(dirs) == 0 {
+		fmt.Printf("%s: No directories match %s\n", repoName, perDirGlob)
+		return nil, nil
+	}
+
+	var results []*dirResults
+	for _, dir := range dirs {
+		fmt.Printf("%s: 🏃‍♂️ Running script in %s\n", repoName, dir)
+		stdout, stderr, exitCode, err := runTranscribedCommand(context.Background(), repoName, "script in "+dir, filepath.Join(repoPath, dir), script)
+		if err != nil {
+			return nil, fmt.Errorf("error running script in %s: %w", dir, err)
+		}
+		results = append(results, &dirResults{
+			Dir:      dir,
+			Stdout:   string(stdout),
+			Stderr:   string(stderr),
+			ExitCode: exitCode,
+		})
+	}
+	return results, nil
+}
+
+// Combine per-directory results into an exit code, outcome and stderr for the whole repo.
+// The first failing directory fails the repo, otherwise it gets the outcome needing the most attention of the
+// directories which weren't skipped, and is skipped if they all were. The stderr is that of the failing directory, or
+// of every directory which warned or needs manual follow-up
+func combineDirResults(dirs []*dirResults) (int, string, []byte) {
+	exitCode, outcome := defaultSkipExitCode, outcomeSkipped
+	var stderr []byte
+	for _, d := range dirs {
+		dirOutcome := outcomeForExitCode(d.ExitCode)
+		switch {
+		case dirOutcome == outcomeSkipped:
+		case !outcomeAllowsPr(dirOutcome):
+			return d.ExitCode, dirOutcome, []byte(fmt.Sprintf("%s: %s", d.Dir, d.Stderr))
+		case outcome == outcomeSkipped || worseOutcome(outcome, dirOutcome) != outcome:
+			exitCode, outcome = d.ExitCode, dirOutcome
+		}
+		if dirOutcome == outcomeWarned || dirOutcome == outcomeManual {
+			stderr = append(stderr, fmt.Sprintf("%s: %s", d.Dir, d.Stderr)...)
+		}
+	}
+	return exitCode, outcome, stderr
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import "testing"
+
+func TestCombineDirResults(t *testing.T) {
+	exitCodesSpec = "10=skip,20=warn,30=manual"
+	defer func() {
+		exitCodesSpec = defaultExitCodes
+		parseExitCodes()
+	}()
+	if err := parseExitCodes(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		dirs         []*dirResults
+		wantExitCode int
+		wantOutcome  string
+		wantStderr   string
+	}{
+		{
+			name:         "all skipped",
+			dirs:         []*dirResults{{Dir: "a", ExitCode: 10}, {Dir: "b", ExitCode: 10}},
+			wantExitCode: 10,
+			wantOutcome:  outcomeSkipped,
+		},
+		{
+			name:        "succeeded",
+			dirs:        []*dirResults{{Dir: "a", ExitCode: 10}, {Dir: "b", Stderr: "noise\n"}},
+			wantOutcome: outcomeSucceeded,
+		},
+		{
+			name:         "first failure",
+			dirs:         []*dirResults{{Dir: "a", ExitCode: 20, Stderr: "deprecated\n"}, {Dir: "b", ExitCode: 1, Stderr: "boom\n"}, {Dir: "c", ExitCode: 2}},
+			wantExitCode: 1,
+			wantOutcome:  outcomeFailed,
+			wantStderr:   "b: boom\n",
+		},
+		{
+			name:         "warned",
+			dirs:         []*dirResults{{Dir: "a", ExitCode: 20, Stderr: "deprecated\n"}, {Dir: "b"}, {Dir: "c", ExitCode: 20, Stderr: "old api\n"}},
+			wantExitCode: 20,
+			wantOutcome:  outcomeWarned,
+			wantStderr:   "a: deprecated\nc: old api\n",
+		},
+		{
+			name:         "manual beats warned",
+			dirs:         []*dirResults{{Dir: "a", ExitCode: 20, Stderr: "deprecated\n"}, {Dir: "b", ExitCode: 30, Stderr: "check me\n"}},
+			wantExitCode: 30,
+			wantOutcome:  outcomeManual,
+			wantStderr:   "a: deprecated\nb: check me\n",
+		},
+	}
+	for _, tt := range tests {
+		exitCode, outcome, stderr := combineDirResults(tt.dirs)
+		if exitCode != tt.wantExitCode || outcome != tt.wantOutcome || string(stderr) != tt.wantStderr {
+			t.Errorf("%s: got %d, %s, %q, want %d, %s, %q", tt.name, exitCode, outcome, stderr, tt.wantExitCode, tt.wantOutcome, tt.wantStderr)
+		}
+	}
+}
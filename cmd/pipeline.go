@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A single named step of a pipeline
+type pipelineStep struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Directory to run the command in, relative to the repository root
+	Dir string `json:"dir"`
+	// Maximum time the step may run for, e.g. "10m". No limit if empty
+	Timeout string `json:"timeout"`
+	// Exit codes which count as success, defaults to just 0
+	AllowedExitCodes []int `json:"allowedExitCodes"`
+	// Carry on with the next step even if this one fails
+	ContinueOnError bool `json:"continueOnError"`
+
+	timeout time.Duration
+}
+
+// Results from a single pipeline step
+type stepResults struct {
+	Name       string `json:"name"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exitCode"`
+	Outcome    string `json:"outcome"`
+	TimedOut   bool   `json:"timedOut,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Check every step of a pipeline is runnable
+func validatePipeline(steps []*pipelineStep) error {
+	names := map[string]bool{}
+	for i, step := range steps {
+		if step.Name == "" {
+			return fmt.Errorf("step %d has no name", i+1)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("step name '%s' is used more than once", step.Name)
+		}
+		names[step.Name] = true
+		if step.Command == "" {
+			return fmt.Errorf("step '%s' has no command", step.Name)
+		}
+		if filepath.IsAbs(step.Dir) || strings.HasPrefix(filepath.Clean(step.Dir), "..") {
+			return fmt.Errorf("step '%s' dir must be inside the repository", step.Name)
+		}
+		if step.Timeout != "" {
+			timeout, err := time.ParseDuration(step.Timeout)
+			if err != nil {
+				return fmt.Errorf("step '%s' has an invalid timeout: %w", step.Name, err)
+			}
+			step.timeout = timeout
+		}
+		if len(step.AllowedExitCodes) == 0 {
+			step.AllowedExitCodes = []int{0}
+		}
+	}
+	return nil
+}
+
+// Whether the exit code counts as success for the step
+func (s *pipelineStep) allows(exitCode int) bool {
+	for _, allowed := range s.AllowedExitCodes {
+		if exitCode == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Run each pipeline step in order, returning the per-step results and the exit code of the pipeline as a whole.
+// A step exiting with a skip code skips the repo and a failing step fails it, both stop the pipeline
+// unless the step is continueOnError. Steps exiting with a code which still allows a PR, e.g. a warning, carry on
+// and the pipeline exits with the code of the one needing the most attention
+func runPipelineInRepo(repoName, repoPath string) ([]*stepResults, int, error) {
+	var results []*stepResults
+	pipelineExitCode := 0
+	for _, step := range cfg.Pipeline {
+		fmt.Printf("%s: 🏃‍♂️ Running step %s\n", repoName, step.Name)
+		r, err := runPipelineStep(repoName, repoPath, step)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error running step %s: %w", step.Name, err)
+		}
+		results = append(results, r)
+
+		outcome := outcomeForExitCode(r.ExitCode)
+		switch {
+		case step.allows(r.ExitCode):
+			r.Outcome = outcomeSucceeded
+		case outcome == outcomeSkipped:
+			r.Outcome = outcomeSkipped
+			return results, r.ExitCode, nil
+		case outcomeAllowsPr(outcome):
+			r.Outcome = outcome
+			if worseOutcome(outcomeForExitCode(pipelineExitCode), outcome) == outcome {
+				pipelineExitCode = r.ExitCode
+			}
+		default:
+			r.Outcome = outcomeFailed
+			if !step.ContinueOnError {
+				return results, r.ExitCode, nil
+			}
+			fmt.Printf("%s: Step %s failed, continuing\n", repoName, step.Name)
+		}
+	}
+	return results, pipelineExitCode, nil
+}
+
+func runPipelineStep(repoName, repoPath string, step *pipelineStep) (*stepResults, error) {
+	ctx := context.Background()
+	if step.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	stdout, stderr, exitCode, err := runTranscribedCommand(ctx, repoName, "step "+step.Name, filepath.Join(repoPath, step.Dir), "sh", "-c", step.Command)
+	if err != nil {
+		return nil, err
+	}
+	r := &stepResults{
+		Name:       step.Name,
+		Stdout:     string(stdout),
+		Stderr:     string(stderr),
+		ExitCode:   exitCode,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		r.TimedOut = true
+		r.Stderr += fmt.Sprintf("timed out after %s\n", step.timeout)
+	}
+	return r, nil
+}
+
+// Stderr to report for the repo as a whole, that of the last failing step
+func pipelineStderr(steps []*stepResults) []byte {
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].Outcome == outcomeFailed {
+			return []byte(fmt.Sprintf("%s: %s", steps[i].Name, steps[i].Stderr))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// A reviewable record of the changes a campaign would make, written by plan and replayed by apply
+type campaignPlan struct {
+	campaign
+	Repos map[string]*plannedRepo `json:"repos"`
+}
+
+// The planned change to a single repo
+type plannedRepo struct {
+	Results *runResults `json:"results"`
+	// Binary diff of the change against Results.BaseCommit, empty if there is nothing to apply
+	Diff string `json:"diff"`
+}
+
+var (
+	planFile string
+	replan   bool
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Run a campaign without pushing, writing the changes to a plan file for review",
+	Long: `Run a campaign without pushing, writing the changes to a plan file for review.
+
+Clones each repository and runs the script (or applies the patch or pipeline) and all checks exactly as a normal run
+would, but instead of committing records the base commit, resulting diff and results of every repository in a plan
+file. Once reviewed, the plan can be pushed as pull requests with 'repository-mapper apply <plan-file>'.`,
+	Args:         cobra.ArbitraryArgs,
+	RunE:         runPlan,
+	SilenceUsage: true,
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan-file>",
+	Short: "Push and open pull requests for exactly the changes in a plan file",
+	Long: `Push and open pull requests for exactly the changes in a plan file.
+
+Repositories whose default branch has moved since the plan was made are refused, unless --replan is passed in which
+case the script is run again on the latest default branch and the new change is pushed without further review.`,
+	Args:         cobra.ExactArgs(1),
+	RunE:         runApply,
+	SilenceUsage: true,
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&branchName, "branch-name", "b", "", "The branch to create. Should be globally unique.")
+	planCmd.MarkFlagRequired("branch-name")
+	planCmd.Flags().StringVarP(&org, "org", "o", "", "The github organization the repos live in, unless qualified as org/repo.")
+	planCmd.Flags().StringVarP(&title, "title", "t", "", "Title of the PR")
+	planCmd.MarkFlagRequired("title")
+	planCmd.Flags().StringVarP(&description, "description", "d", "", "Description of the PR")
+	planCmd.MarkFlagRequired("description")
+	planCmd.Flags().StringVar(&defaultBranch, "default-branch", "master", "(optional) Default branch to checkout when cloning/fetching, defaults to master")
+	planCmd.Flags().StringVar(&planFile, "out", "", "(optional) Where to write the plan, defaults to ./results/<branch-name>.plan.json")
+	addChangeFlags(planCmd)
+	addMaxFailuresFlag(planCmd)
+	addRepoSourceFlags(planCmd)
+	addAuthFlags(planCmd)
+	rootCmd.AddCommand(planCmd)
+
+	applyCmd.Flags().BoolVar(&replan, "replan", false, "(optional) Re-run the script in repositories whose default branch moved since planning")
+	addEnvFlags(applyCmd)
+	addSecretScanFlags(applyCmd)
+	addOutputFlags(applyCmd)
+	addAuthFlags(applyCmd)
+	rootCmd.AddCommand(applyCmd)
+}
+
+// Run the campaign in every repo and write the plan
+func runPlan(cmd *cobra.Command, args []string) error {
+	args, err := resolveRepos(args, true)
+	if err != nil {
+		return err
+	}
+	err = validateArgs()
+	if err != nil {
+		return err
+	}
+	if planFile == "" {
+		planFile = filepath.Join(".", "results", resultsName()+".plan.json")
+	}
+
+	p := &campaignPlan{Repos: map[string]*plannedRepo{}}
+	p.campaign, err = currentCampaign()
+	if err != nil {
+		return err
+	}
+
+	allResults := map[string]*runResults{}
+	for _, repoName := range args {
+		planned, err := planRepo(repoName)
+		if err != nil {
+			recordError(repoName, err)
+			continue
+		}
+		planned.Results.redact(redactCredentials)
+		recordResults(repoName, planned.Results)
+		logResults(planned.Results)
+		p.Repos[repoName] = planned
+		allResults[repoName] = planned.Results
+	}
+
+	summarizeResults(allResults)
+
+	err = savePlan(p, planFile)
+	if err != nil {
+		return fmt.Errorf("error saving plan: %s\n", err)
+	}
+	fmt.Printf("Plan available in %s\nReview it, then run: repository-mapper apply %s\n", planFile, planFile)
+	_, err = closeResultsLog()
+	if err != nil {
+		return fmt.Errorf("error reading results log: %w", err)
+	}
+	return checkFailures(allResults)
+}
+
+// Clone a repo, make and check the change, and record its diff without committing anything
+func planRepo(repoName string) (*plannedRepo, error) {
+	repoPath, repo, phases, err := prepareRepo(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, _, err := changeAndCheckRepo(repoName, repoPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	r.Phases = append(phases, r.Phases...)
+	planned := &plannedRepo{Results: r}
+	if !outcomeAllowsPr(r.Outcome) {
+		return planned, nil
+	}
+
+	snapshot, err := snapshotWorktree(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.cleanup()
+	diff, err := snapshot.diff(r.BaseCommit, "--binary", "--no-color", "--no-ext-diff")
+	if err != nil {
+		return nil, err
+	}
+	planned.Diff = string(diff)
+	return planned, nil
+}
+
+func savePlan(p *campaignPlan, fp string) error {
+	err := os.MkdirAll(filepath.Dir(fp), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fp, data, 0600)
+}
+
+func loadPlan(fp string) (*campaignPlan, error) {
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	p := &campaignPlan{}
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fp, err)
+	}
+	return p, nil
+}
+
+// Push and open pull requests for every planned change
+func runApply(cmd *cobra.Command, args []string) error {
+	p, err := loadPlan(args[0])
+	if err != nil {
+		return fmt.Errorf("error loading plan: %w", err)
+	}
+
+	// Restore the campaign's settings so replanned repos run exactly as they were planned
+	err = p.restore()
+	if err != nil {
+		return err
+	}
+
+	var repoNames []string
+	for repoName := range p.Repos {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+
+	allResults := map[string]*runResults{}
+	for _, repoName := range repoNames {
+		results, err := applyRepo(repoName, p.Repos[repoName])
+		if err != nil {
+			recordError(repoName, err)
+			continue
+		}
+		results.redact(redactCredentials)
+		recordResults(repoName, results)
+		logResults(results)
+		allResults[repoName] = results
+	}
+
+	summarizeResults(allResults)
+
+	err = saveResults(allResults)
+	if err != nil {
+		return fmt.Errorf("error saving results: %s\n", err)
+	}
+	return checkFailures(allResults)
+}
+
+// Push and open a pull request for a single planned change
+func applyRepo(repoName string, planned *plannedRepo) (*runResults, error) {
+	r := planned.Results
+	if !outcomeAllowsPr(r.Outcome) || planned.Diff == "" {
+		// Nothing to push, keep the planned results so the campaign's results stay complete
+		return r, nil
+	}
+
+	// Phases recorded by apply follow those recorded while planning
+	repoPath, repo, phases, err := prepareRepo(repoName)
+	if err != nil {
+		return nil, err
+	}
+	r.Phases = append(r.Phases, phases...)
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("error getting HEAD: %w", err)
+	}
+	if head.Hash().String() != r.BaseCommit {
+		if !replan {
+			fmt.Printf("%s: %s moved since planning, refusing to apply (pass --replan to re-run the script)\n", repoName, defaultBranch)
+			r.Outcome = outcomeStale
+			return r, nil
+		}
+		fmt.Printf("%s: %s moved since planning, re-running the script\n", repoName, defaultBranch)
+		return runInRepo(repoName, repoPath, repo)
+	}
+
+	err = applyPlannedDiff(repoName, repoPath, planned.Diff)
+	if err != nil {
+		return nil, err
+	}
+	err = makePullRequest(repoName, repoPath, repo, head.Hash(), r)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Apply a planned diff to the worktree
+func applyPlannedDiff(repoName, repoPath, diff string) error {
+	tmp, err := os.CreateTemp("", "repository-mapper-plan-*.diff")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(diff)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: 🩹 Applying planned changes\n", repoName)
+	_, stderr, exitCode, err := runCommand(repoPath, "git", "apply", "--binary", tmp.Name())
+	if err != nil {
+		return fmt.Errorf("error applying planned changes: %w", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("error applying planned changes: %s", stderr)
+	}
+	return nil
+}
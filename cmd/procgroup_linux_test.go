@@ -0,0 +1,59 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimedOutCommandKillsChildren(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, exitCode, err := runCommandContext(ctx, dir, "sh", "-c", "sleep 30 & echo $! > child.pid; wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != -1 {
+		t.Errorf("exit code = %d, want -1 for a killed command", exitCode)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("took %s to return after the timeout", elapsed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The child may briefly linger as a zombie until it's reaped, which is as good as gone
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("child process %d is still running", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Whether pid is a live process, zombies waiting to be reaped don't count
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the command name, which is in parentheses
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
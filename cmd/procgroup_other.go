@@ -0,0 +1,8 @@
+//go:build !unix
+
+package cmd
+
+import "os/exec"
+
+// Process groups aren't available, only the command itself is killed when its context is done
+func killProcessGroupOnCancel(c *exec.Cmd) {}
@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the dashboard is redrawn while nothing else changes
+const progressRefresh = 250 * time.Millisecond
+
+var noTui bool
+
+// A repo which is currently being run
+type runningRepo struct {
+	name       string
+	phase      string
+	start      time.Time
+	phaseStart time.Time
+}
+
+// Live dashboard of a run shown on a terminal in place of the per-repo log lines, which are written to a log file
+type progressView struct {
+	mu    sync.Mutex
+	start time.Time
+	total int
+	done  int
+	// Counts of finished repos
+	succeeded, skipped, failed int
+	// Total time taken by finished repos, used for the ETA
+	elapsed time.Duration
+	running map[string]*runningRepo
+	// Lines to print above the dashboard on the next draw
+	finished []string
+	// Number of lines the dashboard took when last drawn
+	height int
+	// Width of the terminal, lines are cut short so they never wrap
+	width int
+
+	terminal       *os.File
+	stdout, stderr *os.File
+	pipe           *os.File
+	logPath        string
+	logDone        chan struct{}
+	stop           chan struct{}
+	drawDone       chan struct{}
+}
+
+// The dashboard of the current run, nil when plain line logs are shown
+var progress *progressView
+
+// Whether the dashboard can be shown, it needs a terminal to draw on and would hide prompts and streamed output
+func useProgressView() bool {
+	if noTui || interactive || stream {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// Show the dashboard for a run of total repos if stdout is a terminal. Everything printed until stopProgress is
+// written to the run's log file instead
+func startProgress(total int) error {
+	if !useProgressView() {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Join(".", "results"), 0700)
+	if err != nil {
+		return err
+	}
+	logPath := runResultsPath(".log")
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+
+	p := &progressView{
+		start:    time.Now(),
+		total:    total,
+		width:    terminalWidth(),
+		running:  map[string]*runningRepo{},
+		terminal: os.Stdout,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		pipe:     writer,
+		logPath:  logPath,
+		logDone:  make(chan struct{}),
+		stop:     make(chan struct{}),
+		drawDone: make(chan struct{}),
+	}
+	fmt.Fprintf(p.terminal, "Logs for this run are written to ./%s\n", logPath)
+	os.Stdout = writer
+	os.Stderr = writer
+	go func() {
+		io.Copy(logFile, reader)
+		logFile.Close()
+		reader.Close()
+		close(p.logDone)
+	}()
+	go func() {
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.draw()
+			case <-p.stop:
+				close(p.drawDone)
+				return
+			}
+		}
+	}()
+	progress = p
+	return nil
+}
+
+// Remove the dashboard's hold on stdout and stderr, leaving its final state on the terminal
+func stopProgress() {
+	p := progress
+	if p == nil {
+		return
+	}
+	progress = nil
+	close(p.stop)
+	<-p.drawDone
+	os.Stdout = p.stdout
+	os.Stderr = p.stderr
+	p.pipe.Close()
+	<-p.logDone
+	p.draw()
+}
+
+// Note a repo has started
+func (p *progressView) startRepo(repoName string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.running[repoName] = &runningRepo{name: repoName, start: now, phaseStart: now}
+}
+
+// Note a running repo has moved on to a new phase
+func (p *progressView) phase(repoName, phase string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if running, ok := p.running[repoName]; ok {
+		running.phase = phase
+		running.phaseStart = time.Now()
+	}
+}
+
+// Note a repo has finished, with either its results or the error which stopped it
+func (p *progressView) finishRepo(repoName string, r *runResults, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	running, ok := p.running[repoName]
+	if ok {
+		p.elapsed += time.Since(running.start)
+		delete(p.running, repoName)
+	}
+	p.done++
+	var line string
+	switch {
+	case err != nil:
+		p.failed++
+		line = fmt.Sprintf("%s: 🚨 ERROR %s", repoName, strings.SplitN(redactCredentials(err.Error()), "\n", 2)[0])
+	case outcomeAllowsPr(r.Outcome):
+		p.succeeded++
+		line = strings.TrimSpace(fmt.Sprintf("%s: ✅ %s %s", repoName, strings.ToUpper(r.Outcome), r.PullRequest))
+	case r.Outcome == outcomeSkipped:
+		p.skipped++
+		line = fmt.Sprintf("%s: ⏭  SKIPPED", repoName)
+	default:
+		p.failed++
+		line = fmt.Sprintf("%s: 🚨 %s, exited with %d", repoName, strings.ToUpper(r.Outcome), r.ExitCode)
+	}
+	p.finished = append(p.finished, line)
+	p.mu.Unlock()
+	p.draw()
+}
+
+// Redraw the dashboard below any newly finished repos
+func (p *progressView) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := &strings.Builder{}
+	if p.height > 0 {
+		// Move back to the start of the dashboard and clear it
+		fmt.Fprintf(b, "\x1b[%dF\x1b[J", p.height)
+	}
+	for _, line := range p.finished {
+		b.WriteString(line + "\n")
+	}
+	p.finished = nil
+	lines := p.dashboard()
+	for _, line := range lines {
+		b.WriteString(truncateToWidth(line, p.width-1) + "\n")
+	}
+	p.height = len(lines)
+	p.terminal.WriteString(b.String())
+}
+
+// Lines of the dashboard: overall counts and timing, then each running repo and its phase
+func (p *progressView) dashboard() []string {
+	elapsed := time.Since(p.start)
+	eta := "unknown"
+	if p.done > 0 {
+		remaining := p.total - p.done
+		eta = (p.elapsed / time.Duration(p.done) * time.Duration(remaining)).Round(time.Second).String()
+	}
+	queued := p.total - p.done - len(p.running)
+	lines := []string{
+		fmt.Sprintf("%d/%d done · %d queued · %d running · elapsed %s · ETA %s",
+			p.done, p.total, queued, len(p.running), elapsed.Round(time.Second), eta),
+		fmt.Sprintf("✅ %d succeeded · ⏭  %d skipped · 🚨 %d failed", p.succeeded, p.skipped, p.failed),
+	}
+
+	var names []string
+	for name := range p.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		running := p.running[name]
+		phase := running.phase
+		if phase == "" {
+			phase = "starting"
+		}
+		lines = append(lines, fmt.Sprintf("  🏃 %s: %s (%s)", name, phase, time.Since(running.phaseStart).Round(time.Second)))
+	}
+	return lines
+}
+
+// Width of the terminal in columns, from stty or $COLUMNS
+func terminalWidth() int {
+	c := exec.Command("stty", "size")
+	c.Stdin = os.Stdin
+	out, err := c.Output()
+	if err == nil {
+		// Output is "<rows> <columns>"
+		fields := strings.Fields(string(out))
+		if len(fields) == 2 {
+			if width, err := strconv.Atoi(fields[1]); err == nil && width > 0 {
+				return width
+			}
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// Cut a line short so it takes at most width columns, counting emoji as two columns wide
+func truncateToWidth(line string, width int) string {
+	columns := 0
+	for i, r := range line {
+		w := 1
+		switch {
+		case r == 0xFE0F:
+			// Variation selectors don't take up any room
+			w = 0
+		case r >= 0x1F000 || (r >= 0x2600 && r <= 0x27BF) || r == 0x23ED:
+			w = 2
+		}
+		if columns+w > width {
+			return line[:i]
+		}
+		columns += w
+	}
+	return line
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+)
+
+var refreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Re-run a campaign's script on the latest default branch of every open PR",
+	Long: `Re-run a campaign's script on the latest default branch of every open PR.
+
+Reads the results of a previous run for --branch-name, and for each repository whose pull request is still open
+re-clones the default branch, re-runs the script (or re-applies the patch, with the same --patch-fuzz and --patch-3way)
+recorded in the results and force-pushes the regenerated commit if it differs from what is currently on the branch.
+Merged and closed pull requests are left alone.
+
+Campaigns run with a pipeline must pass the same --config again, and campaigns run with --exit-codes the same
+--exit-codes.`,
+	Args:         cobra.ArbitraryArgs,
+	RunE:         refresh,
+	SilenceUsage: true,
+}
+
+func init() {
+	refreshCmd.Flags().StringVarP(&branchName, "branch-name", "b", "", "The campaign branch to refresh.")
+	refreshCmd.MarkFlagRequired("branch-name")
+
+	refreshCmd.Flags().StringVarP(&org, "org", "o", "", "The github organization the repos live in, unless qualified as org/repo.")
+
+	refreshCmd.Flags().StringVar(&defaultBranch, "default-branch", "master", "(optional) Default branch to checkout when cloning/fetching, defaults to master")
+
+	addExitCodesFlag(refreshCmd)
+	addOutputFlags(refreshCmd)
+	addEnvFlags(refreshCmd)
+	addSecretScanFlags(refreshCmd)
+	addConfigFlag(refreshCmd)
+	addRepoSourceFlags(refreshCmd)
+	addAuthFlags(refreshCmd)
+	rootCmd.AddCommand(refreshCmd)
+}
+
+// Refresh every open pull request of a campaign, optionally limited to the repos passed as args
+func refresh(cmd *cobra.Command, args []string) error {
+	allResults, err := loadResults(resultsPath())
+	if err != nil {
+		return fmt.Errorf("error loading results: %w", err)
+	}
+
+	err = loadRunSettings()
+	if err != nil {
+		return err
+	}
+	err = initPushing()
+	if err != nil {
+		return err
+	}
+
+	repoNames, err := resolveRepos(args, false)
+	if err != nil {
+		return err
+	}
+	if len(repoNames) == 0 {
+		for repoName := range allResults {
+			repoNames = append(repoNames, repoName)
+		}
+		err = validateRepoNames(repoNames)
+		if err != nil {
+			return err
+		}
+	}
+
+	refreshed := map[string]*runResults{}
+	for _, repoName := range repoNames {
+		prev, ok := allResults[repoName]
+		if !ok {
+			recordError(repoName, fmt.Errorf("not found in %s", resultsPath()))
+			continue
+		}
+		if prev.PullRequest == "" {
+			continue
+		}
+		results, err := refreshRepo(prev)
+		if err != nil {
+			recordError(repoName, err)
+			continue
+		}
+		if results == nil {
+			continue
+		}
+		results.redact(redactCredentials)
+		recordResults(repoName, results)
+		logResults(results)
+		refreshed[repoName] = results
+		allResults[repoName] = results
+	}
+
+	summarizeResults(refreshed)
+
+	err = saveResults(allResults)
+	if err != nil {
+		return fmt.Errorf("error saving results: %s\n", err)
+	}
+	return checkFailures(refreshed)
+}
+
+// Regenerate the branch of a single open pull request, returns nil results if the PR was left alone
+func refreshRepo(prev *runResults) (*runResults, error) {
+	repoName := prev.Repo
+	state, err := pullRequestState(prev.PullRequest)
+	if err != nil {
+		return nil, err
+	}
+	if state != "OPEN" {
+		fmt.Printf("%s: ⏭  Leaving %s pull request alone\n", repoName, strings.ToLower(state))
+		return nil, nil
+	}
+	if prev.Script == "" && prev.Patch == "" && len(cfg.Pipeline) == 0 {
+		return nil, fmt.Errorf("no script or patch recorded in results, pass the pipeline's --config")
+	}
+
+	// The change is made and checked with the settings the repo was run with, put back afterwards so they don't leak
+	// into the next repo
+	defer func(s, p string, fuzz int, threeWay bool, perDir, t, verify string) {
+		script, patchFile, patchFuzz, patchThreeWay, perDirGlob, title, verifyCommand = s, p, fuzz, threeWay, perDir, t, verify
+	}(script, patchFile, patchFuzz, patchThreeWay, perDirGlob, title, verifyCommand)
+	script = prev.Script
+	patchFile = prev.Patch
+	patchFuzz = prev.PatchFuzz
+	patchThreeWay = prev.PatchThreeWay
+	perDirGlob = prev.PerDir
+	verifyCommand = ""
+	if prev.Verify != nil {
+		verifyCommand = prev.Verify.Command
+	}
+	// Results written by older versions have no title, the PR's is the best guess at the commit message
+	title = prev.Title
+	if title == "" && prev.CommitMessage == "" {
+		title, err = pullRequestTitle(prev.PullRequest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	repoPath, repo, phases, err := prepareRepo(repoName)
+	if err != nil {
+		return nil, err
+	}
+	start := startPhase(repoName, phaseFetch)
+	prCommit, err := fetchBranch(repoName, repo)
+	if err != nil {
+		return nil, err
+	}
+	phases = append(phases, endPhase(phaseFetch, start))
+	base, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("error getting HEAD: %w", err)
+	}
+
+	start = time.Now()
+	r, err := changeRepo(repoName, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	r.Phases = append(phases, endPhase(phaseScript, start))
+	r.PullRequest = prev.PullRequest
+	r.BaseCommit = base.Hash().String()
+	r.CommitMessage = prev.CommitMessage
+
+	start = time.Now()
+	err = checkRepo(repoName, repoPath, r)
+	if err != nil {
+		return nil, err
+	}
+	r.addPhase(phaseChecks, start)
+	if !outcomeAllowsPr(r.Outcome) {
+		return r, nil
+	}
+
+	start = time.Now()
+	ahead, err := commitBranch(repoName, repo, r.commitMessage(), base.Hash())
+	if err != nil {
+		return nil, err
+	}
+	r.addPhase(phaseCommit, start)
+	if !ahead {
+		fmt.Printf("%s: Script made no changes on latest %s, leaving branch alone\n", repoName, defaultBranch)
+		return r, nil
+	}
+
+	head, err := repo.Reference(plumbing.NewBranchReferenceName(branchName), true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reference: %w", err)
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	r.ResultCommit = headCommit.Hash.String()
+	if headCommit.TreeHash == prCommit.TreeHash {
+		fmt.Printf("%s: Branch is already up to date\n", repoName)
+		return r, nil
+	}
+
+	fmt.Printf("%s: 🔁 Force pushing regenerated commit\n", repoName)
+	start = time.Now()
+	err = pushBranch(repoName, repo, true)
+	if err != nil {
+		return nil, err
+	}
+	r.addPhase(phasePush, start)
+	return r, nil
+}
+
+// Look up the title of a pull request
+func pullRequestTitle(prURL string) (string, error) {
+	titleCmd := exec.Command("gh", "pr", "view", prURL, "--json", "title", "--jq", ".title")
+	out, err := titleCmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting pull request title: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Look up the state of a pull request (OPEN, CLOSED or MERGED)
+func pullRequestState(prURL string) (string, error) {
+	stateCmd := exec.Command("gh", "pr", "view", prURL, "--json", "state", "--jq", ".state")
+	out, err := stateCmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting pull request state: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Reads a list of repos from stdin in place of a file or argument
+const stdinName = "-"
+
+var (
+	reposFiles   []string
+	includes     []string
+	excludes     []string
+	excludeFiles []string
+	fromResults  string
+	where        string
+
+	// A repo, optionally qualified with the org it lives in, e.g. my-repo or vendasta/my-repo
+	repoRegex          = regexp.MustCompile(`^([\w.-]+/)?[\w.-]+$`)
+	qualifiedRepoRegex = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+)
+
+// Register the flags choosing which repos a command runs, for every command which takes repos as arguments
+func addRepoSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&reposFiles, "repos-file", nil, "(optional) File listing repos to run, one per line with # comments, or '-' for stdin. Can be repeated")
+	cmd.Flags().StringArrayVar(&includes, "include", nil, "(optional) Only run repos matching this glob, or regex between slashes e.g. '/^api-/'. Can be repeated")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "(optional) Don't run repos matching this glob, or regex between slashes e.g. '/-(legacy|old)$/'. Can be repeated")
+	cmd.Flags().StringArrayVar(&excludeFiles, "exclude-file", nil, "(optional) File listing --exclude patterns, one per line with # comments, or '-' for stdin. Can be repeated")
+	cmd.Flags().StringVar(&fromResults, "from-results", "", "(optional) Also run the repos in this results file, e.g. those a query campaign found. Filter them with --where")
+	cmd.Flags().StringVar(&where, "where", "", "(optional) Only take repos from --from-results matching this expression, e.g. 'outcome = succeeded and stdout ~ dep'. See 'results select --help'")
+}
+
+// Resolve the repos a command runs from its args, --repos-file and --from-results, keeping those matching an --include
+// pattern (if any are given) and leaving out --exclude patterns and duplicates. The resolved list is echoed so it can be checked. When required, at least one repo is needed
+func resolveRepos(args []string, required bool) ([]string, error) {
+	if where != "" && fromResults == "" {
+		return nil, fmt.Errorf("--where requires --from-results")
+	}
+	stdin := &stdinList{}
+
+	var candidates []string
+	for _, arg := range args {
+		if arg == stdinName {
+			lines, err := stdin.read()
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, lines...)
+			continue
+		}
+		candidates = append(candidates, arg)
+	}
+	for _, fp := range reposFiles {
+		lines, err := readListFile(fp, stdin)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, lines...)
+	}
+	if fromResults != "" {
+		selected, err := selectRepos(fromResults, where)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, selected...)
+	}
+
+	patterns := append([]string{}, excludes...)
+	for _, fp := range excludeFiles {
+		lines, err := readListFile(fp, stdin)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, lines...)
+	}
+	excludeMatchers, err := parseRepoPatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	includeMatchers, err := parseRepoPatterns(includes)
+	if err != nil {
+		return nil, err
+	}
+	repoNames, duplicates, excluded := filterRepos(candidates, includeMatchers, excludeMatchers)
+
+	sourced := len(reposFiles) > 0 || fromResults != "" || stdin.used
+	if len(repoNames) == 0 {
+		if required || sourced {
+			return nil, fmt.Errorf("No repos to run, pass them as arguments, in --repos-file or select them with --from-results")
+		}
+		return nil, nil
+	}
+	if !local {
+		err = validateRepoNames(repoNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("Resolved %d repos (%d duplicates, %d excluded):\n", len(repoNames), duplicates, excluded)
+	for _, repoName := range repoNames {
+		fmt.Printf("  %s\n", repoName)
+	}
+	return repoNames, nil
+}
+
+// Drop duplicates from the candidate repos, and those which don't match an include (when there are any) or match an
+// exclude. Returns the repos left and how many were dropped as duplicates and excluded
+func filterRepos(candidates []string, includes, excludes []repoMatcher) (repoNames []string, duplicates int, excluded int) {
+	seen := map[string]bool{}
+	for _, repoName := range candidates {
+		// The same repo may be given both with and without its org
+		key := repoName
+		if !local {
+			key = qualifiedRepo(repoName)
+		}
+		if seen[key] {
+			duplicates++
+			continue
+		}
+		seen[key] = true
+		if (len(includes) > 0 && !matchesAny(includes, repoName)) || matchesAny(excludes, repoName) {
+			excluded++
+			continue
+		}
+		repoNames = append(repoNames, repoName)
+	}
+	return repoNames, duplicates, excluded
+}
+
+// Check repo names are repo or org/repo, and that an org was given for those which aren't qualified
+func validateRepoNames(repoNames []string) error {
+	for _, repoName := range repoNames {
+		if strings.ContainsAny(repoName, "*?[") {
+			return fmt.Errorf("Invalid repo %s, patterns are only supported by --include and --exclude", repoName)
+		}
+		if !repoRegex.MatchString(repoName) {
+			return fmt.Errorf("Invalid repo %s, expected repo or org/repo", repoName)
+		}
+		if org == "" && !qualifiedRepoRegex.MatchString(repoName) {
+			return fmt.Errorf("An org is required for %s. Pass one with -o or qualify the repo as org/repo", repoName)
+		}
+	}
+	return nil
+}
+
+// The repo qualified with its org, repos which aren't qualified live in --org
+func qualifiedRepo(repoName string) string {
+	if strings.Contains(repoName, "/") {
+		return repoName
+	}
+	return org + "/" + repoName
+}
+
+// Stdin, read at most once however many times '-' is passed
+type stdinList struct {
+	used bool
+}
+
+func (s *stdinList) read() ([]string, error) {
+	if s.used {
+		return nil, nil
+	}
+	s.used = true
+	lines, err := parseList(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stdin: %w", err)
+	}
+	return lines, nil
+}
+
+// Read a list of repos or patterns from a file, or stdin for '-'
+func readListFile(fp string, stdin *stdinList) ([]string, error) {
+	if fp == stdinName {
+		return stdin.read()
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines, err := parseList(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", fp, err)
+	}
+	return lines, nil
+}
+
+// Entries of a list, one per line. Blank lines and everything after a # are ignored
+func parseList(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// Matches repo names against a pattern
+type repoMatcher func(repoName string) bool
+
+// Parse --include and --exclude patterns: regexes between slashes, otherwise globs. Globs without a / also match the repo part of
+// org/repo names
+func parseRepoPatterns(patterns []string) ([]repoMatcher, error) {
+	var matchers []repoMatcher
+	for _, pattern := range patterns {
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			regex, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("error parsing pattern %s: %w", pattern, err)
+			}
+			matchers = append(matchers, regex.MatchString)
+			continue
+		}
+		glob := pattern
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("error parsing pattern %s: %w", pattern, err)
+		}
+		matchers = append(matchers, func(repoName string) bool {
+			if ok, _ := path.Match(glob, repoName); ok {
+				return true
+			}
+			if strings.Contains(glob, "/") {
+				return false
+			}
+			ok, _ := path.Match(glob, pathBase(repoName))
+			return ok
+		})
+	}
+	return matchers, nil
+}
+
+func matchesAny(matchers []repoMatcher, repoName string) bool {
+	for _, match := range matchers {
+		if match(repoName) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterRepos(t *testing.T) {
+	org = "vendasta"
+	defer func() { org = "" }()
+
+	candidates := []string{"api-users", "web-app", "vendasta/api-users", "other/api-billing", "api-legacy", "web-app"}
+	tests := []struct {
+		includes, excludes []string
+		want               []string
+		duplicates         int
+		excluded           int
+	}{
+		{want: []string{"api-users", "web-app", "other/api-billing", "api-legacy"}, duplicates: 2},
+		{includes: []string{"api-*"}, want: []string{"api-users", "other/api-billing", "api-legacy"}, duplicates: 2, excluded: 1},
+		{includes: []string{"api-*"}, excludes: []string{"*-legacy"}, want: []string{"api-users", "other/api-billing"}, duplicates: 2, excluded: 2},
+		{includes: []string{"other/*", "/^web-/"}, want: []string{"web-app", "other/api-billing"}, duplicates: 2, excluded: 2},
+		{includes: []string{"nothing-*"}, duplicates: 2, excluded: 4},
+	}
+	for _, tt := range tests {
+		includes, err := parseRepoPatterns(tt.includes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		excludes, err := parseRepoPatterns(tt.excludes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, duplicates, excluded := filterRepos(candidates, includes, excludes)
+		if !reflect.DeepEqual(got, tt.want) || duplicates != tt.duplicates || excluded != tt.excluded {
+			t.Errorf("filterRepos(include %q, exclude %q) = %q, %d duplicates, %d excluded, want %q, %d duplicates, %d excluded",
+				tt.includes, tt.excludes, got, duplicates, excluded, tt.want, tt.duplicates, tt.excluded)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	gitobject "github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
@@ -83,7 +84,7 @@ func checkoutRepo(repoName, repoPath, defaultBranch string) (repo *git.Repositor
 
 func cloneRepo(repoName, dest, defaultBranch string) (*git.Repository, error) {
 	fmt.Printf("%s: 🧘‍♂️ Cloning (this could take a while...)\n", repoName)
-	githubRepoURL := fmt.Sprintf("https://github.com/%s/%s", org, repoName)
+	githubRepoURL := "https://github.com/" + qualifiedRepo(repoName)
 	cloneOptions := &git.CloneOptions{
 		URL:           githubRepoURL,
 		ReferenceName: plumbing.NewBranchReferenceName(defaultBranch),
@@ -148,28 +149,95 @@ func checkoutBranch(repoName string, repo *git.Repository, defaultBranch string)
 	return nil
 }
 
-// Make a pull request
-func makePullRequest(repoName string, repoPath string, repo *git.Repository) (string, error) {
+// Commit the change, push it and make a pull request, recording the pull request and the time each step took in r
+func makePullRequest(repoName string, repoPath string, repo *git.Repository, base plumbing.Hash, r *runResults) error {
+	start := startPhase(repoName, phaseCommit)
+	ahead, err := commitBranch(repoName, repo, r.commitMessage(), base)
+	if err != nil {
+		return err
+	}
+	r.addPhase(phaseCommit, start)
+	if !ahead {
+		return nil
+	}
+	r.setResultCommit(repo)
+
+	start = startPhase(repoName, phasePush)
+	err = pushBranch(repoName, repo, false)
+	if err != nil {
+		return err
+	}
+	r.addPhase(phasePush, start)
+
+	start = startPhase(repoName, phasePr)
+	r.PullRequest, err = createPullRequest(repoName, repoPath)
+	if err != nil {
+		return err
+	}
+	r.addPhase(phasePr, start)
+	return nil
+}
+
+// Commit any changes left in the worktree, and report whether the branch now has commits on top of base.
+// Commits the script made itself are kept as they are
+func commitBranch(repoName string, repo *git.Repository, message string, base plumbing.Hash) (bool, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return false, fmt.Errorf("error getting HEAD: %w", err)
+	}
+	if head.Name() != plumbing.NewBranchReferenceName(branchName) {
+		return false, fmt.Errorf("script must leave %s checked out, found %s", branchName, head.Name().Short())
+	}
+
+	committed, err := commitChanges(repoName, repo, message)
+	if err != nil {
+		return false, err
+	}
+	if committed {
+		return true, nil
+	}
+	if head.Hash() != base {
+		fmt.Printf("%s: Keeping commits made by the script\n", repoName)
+		return true, nil
+	}
+	return false, nil
+}
+
+// Stage and commit every change in the worktree, returns false if there was nothing to commit.
+// Changes matching the config's commitSplits are committed separately
+func commitChanges(repoName string, repo *git.Repository, message string) (bool, error) {
 	wt, err := repo.Worktree()
 	if err != nil {
-		return "", fmt.Errorf("error getting worktree: %w", err)
+		return false, fmt.Errorf("error getting worktree: %w", err)
 	}
 
 	st, err := wt.Status()
 	if err != nil {
-		return "", fmt.Errorf("error checking git status: %w", err)
+		return false, fmt.Errorf("error checking git status: %w", err)
 	}
 	if st.IsClean() {
-		return "", nil
+		return false, nil
+	}
+	if len(cfg.CommitSplits) > 0 {
+		return true, commitSplitChanges(repoName, wt, st, message)
 	}
 	// Add all changed files
 	err = wt.AddWithOptions(&git.AddOptions{
 		All: true,
 	})
 	if err != nil {
-		return "", fmt.Errorf("error adding changes: %w", err)
+		return false, fmt.Errorf("error adding changes: %w", err)
 	}
 
+	err = commitIndex(repoName, wt, message)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Commit whatever is currently staged
+func commitIndex(repoName string, wt *git.Worktree, message string) error {
 	committer := &gitobject.Signature{
 		Name:  gitAuthor,
 		Email: gitAuthorEmail,
@@ -181,22 +249,55 @@ func makePullRequest(repoName string, repoPath string, repo *git.Repository) (st
 		Committer: committer,
 	}
 	fmt.Printf("%s: 📝 Committing Changes\n", repoName)
-	_, err = wt.Commit(title, commitOpts)
+	_, err := wt.Commit(message, commitOpts)
 	if err != nil {
-		return "", fmt.Errorf("error committing changes: %w", err)
+		return fmt.Errorf("error committing changes: %w", err)
 	}
+	return nil
+}
 
-	// Push to origin
+// Push the campaign branch to origin, replacing the remote branch when force is set
+func pushBranch(repoName string, repo *git.Repository, force bool) error {
+	refSpec := fmt.Sprintf("refs/heads/%s:refs/heads/%s", branchName, branchName)
+	if force {
+		refSpec = "+" + refSpec
+	}
 	pushOpts := &git.PushOptions{
 		RemoteName: "origin",
 		Auth:       auth,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
 	}
 	fmt.Printf("%s: Setting upstream origin to %s\n", repoName, branchName)
-	err = repo.Push(pushOpts)
+	err := repo.Push(pushOpts)
 	if err != nil {
-		return "", fmt.Errorf("error during push: %w", err)
+		return fmt.Errorf("error during push: %w", err)
 	}
+	return nil
+}
+
+// Fetch the campaign branch from origin and return the commit it points to
+func fetchBranch(repoName string, repo *git.Repository) (*gitobject.Commit, error) {
+	fmt.Printf("%s: Fetching %s\n", repoName, branchName)
+	remoteRef := plumbing.NewRemoteReferenceName("origin", branchName)
+	opts := &git.FetchOptions{
+		RemoteName: "origin",
+		Depth:      1,
+		Auth:       auth,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+refs/heads/%s:%s", branchName, remoteRef))},
+	}
+	err := repo.Fetch(opts)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("error fetching: %w", err)
+	}
+	ref, err := repo.Reference(remoteRef, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reference: %w", err)
+	}
+	return repo.CommitObject(ref.Hash())
+}
 
+// Open a pull request for the pushed campaign branch and return its url
+func createPullRequest(repoName string, repoPath string) (string, error) {
 	//create pull request
 	// TODO: replace gh's command usage with  https://github.com/cli/go-gh
 	fmt.Printf("%s: 📝 Making Pull Request\n", repoName)
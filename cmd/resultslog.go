@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A line of the results log, either the header of the run, the results of a repo or the error which stopped it running
+type resultsLogEntry struct {
+	Run *runHeader `json:"run,omitempty"`
+	// Key of the repo in the results, as it was passed on the command line
+	Repo    string      `json:"repo,omitempty"`
+	Results *runResults `json:"results,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Append-only log of the results of each repo as soon as it completes, so nothing is lost if the run dies
+type resultsLog struct {
+	path string
+	f    *os.File
+}
+
+// Log of the current run, opened when the first repo completes
+var runLog *resultsLog
+
+// Name of the files belonging to this run, unique to the time it started and the process running it so runs started
+// at the same moment don't overwrite each other
+func runName() string {
+	return fmt.Sprintf("%s.%s-%d", resultsName(), header.StartedAt.Format("20060102T150405.000000Z"), os.Getpid())
+}
+
+// Path of a file belonging to this run, e.g. its results log
+func runResultsPath(ext string) string {
+	return filepath.Join(".", "results", runName()+ext)
+}
+
+func openResultsLog() (*resultsLog, error) {
+	// Results may contain sensitive output so only the current user can read them
+	err := os.MkdirAll(filepath.Join(".", "results"), 0700)
+	if err != nil {
+		return nil, err
+	}
+	fp := runResultsPath(".jsonl")
+	f, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &resultsLog{path: fp, f: f}
+	err = l.write(&resultsLogEntry{Run: header})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write an entry as a single line and flush it to disk
+func (l *resultsLog) write(entry *resultsLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = l.f.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Append the results of a repo to the log of the current run. Failing to log doesn't stop the run, the results are
+// still saved at the end
+func recordResults(repoName string, r *runResults) {
+	if !openRunLog() {
+		return
+	}
+	err := runLog.write(&resultsLogEntry{Repo: repoName, Results: r})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error logging results: %s\n", repoName, err)
+	}
+}
+
+// Append the error which stopped a repo running to the log of the current run
+func logError(repoName, message string) {
+	if !openRunLog() {
+		return
+	}
+	err := runLog.write(&resultsLogEntry{Repo: repoName, Error: message})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error logging error: %s\n", repoName, err)
+	}
+}
+
+// Open the log of the current run if it isn't already, returns false if it can't be
+func openRunLog() bool {
+	if runLog != nil {
+		return true
+	}
+	l, err := openResultsLog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening results log: %s\n", err)
+		return false
+	}
+	runLog = l
+	return true
+}
+
+// Close the log of the current run and read back the results and errors logged in it, nil if nothing was logged
+func closeResultsLog() (*resultsFile, error) {
+	if runLog == nil {
+		return nil, nil
+	}
+	runLog.f.Close()
+	fp := runLog.path
+	runLog = nil
+	return loadResultsLog(fp)
+}
+
+// Read a results log, e.g. one left behind by a run which didn't finish. A partially written last line is ignored
+func loadResultsLog(fp string) (*resultsFile, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	results := &resultsFile{Run: &runHeader{}, Repos: map[string]*runResults{}, Errors: map[string]string{}}
+	reader := bufio.NewReader(f)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Anything after the last newline was cut off mid-write
+			break
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entry := &resultsLogEntry{}
+		err = json.Unmarshal([]byte(line), entry)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s:%d: %w", fp, lineNum, err)
+		}
+		if entry.Run != nil {
+			results.Run = entry.Run
+		}
+		if entry.Results != nil {
+			results.Repos[entry.Repo] = entry.Results
+		}
+		if entry.Error != "" {
+			results.Errors[entry.Repo] = entry.Error
+		}
+	}
+	return results, nil
+}
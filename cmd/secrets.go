@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// A high-confidence secret pattern
+type secretRule struct {
+	name    string
+	pattern *regexp.Regexp
+	// Minimum Shannon entropy (bits per character) of the match, 0 to accept every match
+	minEntropy float64
+	// Capture group holding the secret itself, 0 for the whole match
+	group int
+}
+
+var secretRules = []*secretRule{
+	{name: "aws-access-key-id", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "github-token", pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{name: "github-fine-grained-token", pattern: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{
+		name:       "high-entropy-secret",
+		pattern:    regexp.MustCompile(`(?i)(?:secret|token|passw(?:or)?d|api[_-]?key|access[_-]?key|credential)s?[\w.-]{0,20}["']?\s*[:=]\s*["']?([A-Za-z0-9+/=_.\-]{20,})`),
+		minEntropy: 4,
+		group:      1,
+	},
+}
+
+// A secret found in a line added by the campaign
+type secretFinding struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+	// The secret with all but its first few characters masked
+	Redacted string `json:"redacted"`
+
+	secret string
+}
+
+// Findings allowed by the --secrets-allowlist file
+type secretAllowlist struct {
+	// Globs of paths which aren't scanned
+	paths []string
+	// Patterns of secrets which are ignored
+	secrets []*regexp.Regexp
+}
+
+var (
+	noSecretScan       bool
+	secretsAllowlistFp string
+	allowlist          = &secretAllowlist{}
+
+	// Captures the first line number in the new file of a unified diff hunk
+	hunkHeaderRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+)
+
+// Register the secret scanning flags on a command
+func addSecretScanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noSecretScan, "no-secret-scan", false, "(optional) Don't scan changes for secrets before committing them")
+	cmd.Flags().StringVar(&secretsAllowlistFp, "secrets-allowlist", "", "(optional) File of secret patterns and 'path:<glob>' lines to ignore when scanning for secrets")
+}
+
+// Read the allowlist file. Each line is either 'path:<glob>' to skip matching files, or a regex of secrets to ignore.
+// Blank lines and lines starting with '#' are ignored
+func loadSecretAllowlist() error {
+	if secretsAllowlistFp == "" {
+		return nil
+	}
+	f, err := os.Open(secretsAllowlistFp)
+	if err != nil {
+		return fmt.Errorf("error reading secrets allowlist: %w", err)
+	}
+	defer f.Close()
+
+	a := &secretAllowlist{}
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if glob, ok := strings.CutPrefix(line, "path:"); ok {
+			err = validateGlob(glob)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid path glob: %w", secretsAllowlistFp, lineNum, err)
+			}
+			a.paths = append(a.paths, glob)
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid pattern: %w", secretsAllowlistFp, lineNum, err)
+		}
+		a.secrets = append(a.secrets, re)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading secrets allowlist: %w", err)
+	}
+	allowlist = a
+	return nil
+}
+
+func (a *secretAllowlist) allowsPath(path string) bool {
+	for _, glob := range a.paths {
+		if matchGlob(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *secretAllowlist) allowsSecret(secret string) bool {
+	for _, re := range a.secrets {
+		if re.MatchString(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	var entropy float64
+	n := float64(len([]rune(s)))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Mask all but the first four characters of a secret
+func redactSecret(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-4)
+}
+
+// Find secrets in the lines added by a unified diff produced with --no-prefix
+func scanDiffForSecrets(diff []byte) []*secretFinding {
+	var findings []*secretFinding
+	var path string
+	var lineNum int
+	// File headers only come between a "diff --git" line and the file's first hunk. Inside a hunk an added line
+	// starting with "++" looks just like a "+++ " header
+	var inHeader, sawOldPath bool
+	for _, line := range strings.Split(string(diff), "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			inHeader = true
+			sawOldPath = false
+			path = ""
+		case inHeader && strings.HasPrefix(line, "--- "):
+			sawOldPath = true
+		case inHeader && sawOldPath && strings.HasPrefix(line, "+++ "):
+			path = strings.TrimPrefix(line, "+++ ")
+			if path == "/dev/null" {
+				// The file was deleted, so nothing was added to it
+				path = ""
+			}
+		case strings.HasPrefix(line, "@@"):
+			inHeader = false
+			if m := hunkHeaderRegex.FindStringSubmatch(line); m != nil {
+				lineNum, _ = strconv.Atoi(m[1])
+			}
+		case inHeader:
+			// Other header lines, e.g. "index", "new file mode" or "Binary files ... differ"
+		case strings.HasPrefix(line, "+"):
+			if !allowlist.allowsPath(path) {
+				findings = append(findings, scanLineForSecrets(path, lineNum, line[1:])...)
+			}
+			lineNum++
+		case strings.HasPrefix(line, " "):
+			lineNum++
+		}
+	}
+	return findings
+}
+
+func scanLineForSecrets(path string, lineNum int, line string) []*secretFinding {
+	var findings []*secretFinding
+	for _, rule := range secretRules {
+		for _, m := range rule.pattern.FindAllStringSubmatch(line, -1) {
+			secret := m[rule.group]
+			if rule.minEntropy > 0 && shannonEntropy(secret) < rule.minEntropy {
+				continue
+			}
+			if allowlist.allowsSecret(secret) {
+				continue
+			}
+			findings = append(findings, &secretFinding{
+				Path:     path,
+				Line:     lineNum,
+				Rule:     rule.name,
+				Redacted: redactSecret(secret),
+				secret:   secret,
+			})
+		}
+	}
+	return findings
+}
+
+// Scan the lines added by a successful change for secrets, marking the results as outcomeSecretsFound if there are any.
+// The secrets are redacted from the results' transcripts
+func scanRepo(repoName, repoPath string, r *runResults) error {
+	if noSecretScan || !outcomeAllowsPr(r.Outcome) {
+		return nil
+	}
+
+	snapshot, err := snapshotWorktree(repoPath)
+	if err != nil {
+		return err
+	}
+	defer snapshot.cleanup()
+	diff, err := snapshot.diff(r.BaseCommit, "--no-prefix", "--no-color", "--no-ext-diff", "-U0")
+	if err != nil {
+		return err
+	}
+
+	r.SecretFindings = scanDiffForSecrets(diff)
+	if len(r.SecretFindings) == 0 {
+		return nil
+	}
+	fmt.Printf("%s: 🔑 Found %d possible secrets in the changes\n", repoName, len(r.SecretFindings))
+	r.Outcome = outcomeSecretsFound
+	var secrets []string
+	for _, f := range r.SecretFindings {
+		secrets = append(secrets, f.secret)
+	}
+	return redactResults(r, secrets)
+}
+
+// Replace every occurrence of the secrets in the results' transcripts and the repo's transcript files with a
+// redacted form
+func redactResults(r *runResults, secrets []string) error {
+	var oldnew []string
+	for _, secret := range secrets {
+		if secret != "" {
+			oldnew = append(oldnew, secret, redactSecret(secret))
+		}
+	}
+	if len(oldnew) == 0 {
+		return nil
+	}
+	replace := strings.NewReplacer(oldnew...).Replace
+	r.redact(replace)
+	return redactTranscripts(r.Repo, replace)
+}
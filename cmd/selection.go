@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// A condition of a --where expression, e.g. json.deps[0].name = "dep"
+	whereConditionRegex = regexp.MustCompile(`^\s*(\w+)((?:\.[\w-]+|\[\d+\])*)\s*(!=|!~|<=|>=|=|~|<|>)\s*(.*?)\s*$`)
+	// A step of the path of a json field, a key or an index
+	wherePathRegex = regexp.MustCompile(`\.([\w-]+)|\[(\d+)\]`)
+	// Separates the conditions of a --where expression, matched where each space outside quotes starts
+	whereAndRegex = regexp.MustCompile(`^\s+and\s+`)
+)
+
+// Fields of the results of a repo which --where can filter on
+const (
+	whereExitCode    = "exitCode"
+	whereOutcome     = "outcome"
+	whereStdout      = "stdout"
+	whereStderr      = "stderr"
+	wherePullRequest = "pullRequest"
+	whereJson        = "json"
+)
+
+var resultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "Work with the results of previous runs",
+}
+
+var selectCmd = &cobra.Command{
+	Use:   "select <results-file>",
+	Short: "Print the repos in a results file matching --where, one per line",
+	Long: `Print the repos in a results file matching --where, one per line.
+
+A --where expression is one or more conditions joined by 'and', each comparing a field of a repo's results to a value:
+
+  exitCode = 0, exitCode != 10, exitCode >= 20        the exit code of the script
+  outcome = succeeded, outcome != skipped             the outcome, e.g. succeeded, skipped or failed
+  stdout ~ 'github.com/golang/dep', stderr !~ warn    whether stdout or stderr match a regex
+  pullRequest ~ github.com                            the URL of the pull request, if one was opened
+  json.deps[0].name = "dep", json.count > 3           a value in stdout parsed as JSON
+
+Values may be quoted with ' or ", and quoted values are always text. Otherwise JSON values are compared as JSON when
+the value parses as JSON (e.g. 3, true or null) and as text when it doesn't. Repos whose stdout isn't JSON never match json conditions.`,
+	Args:         cobra.ExactArgs(1),
+	RunE:         runSelect,
+	SilenceUsage: true,
+}
+
+func init() {
+	selectCmd.Flags().StringVar(&where, "where", "", "(optional) Only print repos matching this expression, e.g. 'outcome = succeeded and stdout ~ dep'")
+	resultsCmd.AddCommand(selectCmd)
+	rootCmd.AddCommand(resultsCmd)
+}
+
+func runSelect(cmd *cobra.Command, args []string) error {
+	repoNames, err := selectRepos(args[0], where)
+	if err != nil {
+		return err
+	}
+	for _, repoName := range repoNames {
+		fmt.Println(repoName)
+	}
+	return nil
+}
+
+// The repos of a results file matching a --where expression, sorted
+func selectRepos(fp, expr string) ([]string, error) {
+	conditions, err := parseWhere(expr)
+	if err != nil {
+		return nil, err
+	}
+	results, err := loadResults(fp)
+	if err != nil {
+		return nil, fmt.Errorf("error loading results: %w", err)
+	}
+
+	var repoNames []string
+	for repoName, r := range results {
+		if conditions.matches(r) {
+			repoNames = append(repoNames, repoName)
+		}
+	}
+	sort.Strings(repoNames)
+	return repoNames, nil
+}
+
+// A parsed --where expression, matching when every condition does
+type whereExpr []*whereCondition
+
+type whereCondition struct {
+	field string
+	// Keys and indexes into the parsed stdout, for json conditions
+	path  []interface{}
+	op    string
+	value string
+	regex *regexp.Regexp
+	// The value as a number, for exitCode conditions
+	number int
+	// The value parsed as JSON, or the value as a string if it isn't JSON
+	jsonValue interface{}
+}
+
+func parseWhere(expr string) (whereExpr, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	var conditions whereExpr
+	for _, part := range splitWhere(strings.TrimSpace(expr)) {
+		c, err := parseWhereCondition(part)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --where '%s': %w", part, err)
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// Split a --where expression into its conditions at each 'and' which isn't inside a quoted value
+func splitWhere(expr string) []string {
+	var parts []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '\'' || c == '"') && (i == 0 || strings.IndexByte(" \t=!~<>", expr[i-1]) >= 0):
+			// Only quotes opening a value count, so e.g. an apostrophe in don't is left alone
+			quote = c
+		case c == ' ' || c == '\t':
+			if loc := whereAndRegex.FindStringIndex(expr[i:]); loc != nil {
+				parts = append(parts, expr[start:i])
+				start = i + loc[1]
+				i = start - 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseWhereCondition(text string) (*whereCondition, error) {
+	m := whereConditionRegex.FindStringSubmatch(text)
+	if m == nil {
+		return nil, fmt.Errorf("expected <field> <op> <value>, e.g. 'outcome = succeeded'")
+	}
+	c := &whereCondition{field: m[1], op: m[3], value: unquote(m[4])}
+	quoted := c.value != m[4]
+	if m[2] != "" && c.field != whereJson {
+		return nil, fmt.Errorf("only json fields have a path")
+	}
+
+	if c.op == "~" || c.op == "!~" {
+		if c.field == whereExitCode {
+			return nil, fmt.Errorf("%s can't be matched against a regex", c.field)
+		}
+		regex, err := regexp.Compile(c.value)
+		if err != nil {
+			return nil, err
+		}
+		c.regex = regex
+	}
+	ordered := c.op == "<" || c.op == ">" || c.op == "<=" || c.op == ">="
+
+	switch c.field {
+	case whereExitCode:
+		number, err := strconv.Atoi(c.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be compared to a number", c.field)
+		}
+		c.number = number
+	case whereOutcome, whereStdout, whereStderr, wherePullRequest:
+		if ordered {
+			return nil, fmt.Errorf("%s can only be compared with =, !=, ~ and !~", c.field)
+		}
+	case whereJson:
+		for _, step := range wherePathRegex.FindAllStringSubmatch(m[2], -1) {
+			if step[1] != "" {
+				c.path = append(c.path, step[1])
+			} else {
+				index, _ := strconv.Atoi(step[2])
+				c.path = append(c.path, index)
+			}
+		}
+		// Quoted values are always text
+		if quoted || json.Unmarshal([]byte(c.value), &c.jsonValue) != nil {
+			c.jsonValue = c.value
+		}
+		if _, ok := c.jsonValue.(float64); ordered && !ok {
+			return nil, fmt.Errorf("%s can only be compared with <, >, <= and >= to a number", c.field)
+		}
+	default:
+		return nil, fmt.Errorf("unknown field '%s', expected one of %s", c.field, strings.Join([]string{whereExitCode, whereOutcome, whereStdout, whereStderr, wherePullRequest, whereJson}, ", "))
+	}
+	return c, nil
+}
+
+// Strip matching single or double quotes from around a value
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func (w whereExpr) matches(r *runResults) bool {
+	for _, c := range w {
+		if !c.matches(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *whereCondition) matches(r *runResults) bool {
+	switch c.field {
+	case whereExitCode:
+		return compareOrdered(c.op, float64(r.ExitCode), float64(c.number))
+	case whereOutcome:
+		return c.matchesText(r.Outcome)
+	case whereStdout:
+		return c.matchesText(strings.TrimSpace(r.Stdout))
+	case whereStderr:
+		return c.matchesText(strings.TrimSpace(r.Stderr))
+	case wherePullRequest:
+		return c.matchesText(r.PullRequest)
+	}
+
+	var doc interface{}
+	if json.Unmarshal([]byte(r.Stdout), &doc) != nil {
+		return false
+	}
+	value := lookupJson(doc, c.path)
+	switch c.op {
+	case "~", "!~":
+		text, ok := value.(string)
+		if !ok {
+			text = jsonValue(value)
+		}
+		return c.regex.MatchString(text) == (c.op == "~")
+	case "=":
+		return jsonEqual(value, c.jsonValue)
+	case "!=":
+		return !jsonEqual(value, c.jsonValue)
+	}
+	number, ok := value.(float64)
+	return ok && compareOrdered(c.op, number, c.jsonValue.(float64))
+}
+
+// Compare text with =, !=, ~ or !~
+func (c *whereCondition) matchesText(text string) bool {
+	switch c.op {
+	case "=":
+		return text == c.value
+	case "!=":
+		return text != c.value
+	}
+	return c.regex.MatchString(text) == (c.op == "~")
+}
+
+func compareOrdered(op string, a, b float64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "<=":
+		return a <= b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// Whether a value from stdout equals the value of a condition, which is a string if it wasn't JSON
+func jsonEqual(value, expected interface{}) bool {
+	if s, ok := expected.(string); ok {
+		if v, ok := value.(string); ok {
+			return v == s
+		}
+		return value != nil && jsonValue(value) == s
+	}
+	return jsonValue(value) == jsonValue(expected)
+}
+
+// Follow a path of keys and indexes into a parsed JSON document, nil if it isn't there
+func lookupJson(doc interface{}, path []interface{}) interface{} {
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			m, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			doc = m[s]
+		case int:
+			a, ok := doc.([]interface{})
+			if !ok || s >= len(a) {
+				return nil
+			}
+			doc = a[s]
+		}
+	}
+	return doc
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWhere(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"outcome = succeeded", []string{"outcome = succeeded"}},
+		{"outcome = succeeded and exitCode = 0", []string{"outcome = succeeded", "exitCode = 0"}},
+		{"stdout ~ 'foo and bar'", []string{"stdout ~ 'foo and bar'"}},
+		{`stdout ~ "foo and bar" and exitCode = 0`, []string{`stdout ~ "foo and bar"`, "exitCode = 0"}},
+		{"stdout ~ don't and exitCode = 0", []string{"stdout ~ don't", "exitCode = 0"}},
+		{"stdout ~ band", []string{"stdout ~ band"}},
+	}
+	for _, tt := range tests {
+		got := splitWhere(tt.expr)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWhere(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	tests := []string{
+		"outcome",
+		"bogus = 1",
+		"exitCode ~ 1",
+		"exitCode = x",
+		"outcome > 1",
+		"stdout.x = 1",
+		"json.count > x",
+		"stdout ~ (",
+	}
+	for _, expr := range tests {
+		if _, err := parseWhere(expr); err == nil {
+			t.Errorf("parseWhere(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestWhereMatches(t *testing.T) {
+	results := map[string]*runResults{
+		"query":   {Outcome: outcomeSucceeded, Stdout: "uses github.com/golang/dep and bar\n"},
+		"json":    {Outcome: outcomeSucceeded, Stdout: `{"deps": [{"name": "dep"}], "count": 4, "ok": true}`},
+		"skipped": {Outcome: outcomeSkipped, ExitCode: 10},
+		"failed":  {Outcome: outcomeFailed, ExitCode: 1, Stderr: "error: boom"},
+	}
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"", []string{"failed", "json", "query", "skipped"}},
+		{"outcome = succeeded", []string{"json", "query"}},
+		{"outcome != succeeded and exitCode >= 1", []string{"failed", "skipped"}},
+		{"exitCode < 10", []string{"failed", "json", "query"}},
+		{"stdout ~ 'golang/dep and bar'", []string{"query"}},
+		{"stderr !~ error and outcome = failed", nil},
+		{`json.deps[0].name = "dep"`, []string{"json"}},
+		{"json.deps[0].name = dep", []string{"json"}},
+		{"json.count > 3 and json.ok = true", []string{"json"}},
+		{"json.ok = 'true'", []string{"json"}},
+		{"json.count = '4.0'", nil},
+		{"json.missing != 1", []string{"json"}},
+	}
+	for _, tt := range tests {
+		conditions, err := parseWhere(tt.expr)
+		if err != nil {
+			t.Errorf("parseWhere(%q): %s", tt.expr, err)
+			continue
+		}
+		var got []string
+		for _, repoName := range []string{"failed", "json", "query", "skipped"} {
+			if conditions.matches(results[repoName]) {
+				got = append(got, repoName)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q matched %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A file changed by the campaign, relative to the commit the branch was created from
+type fileChange struct {
+	Path string `json:"path"`
+	// Status letter from git diff --name-status, e.g. A, M or D
+	Status  string `json:"status"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// Snapshot of everything in a worktree, including untracked files, staged into a temporary index so it can be diffed
+// without touching the repo's real index
+type worktreeSnapshot struct {
+	repoPath  string
+	indexFile string
+}
+
+// Stage the worktree into a copy of the repo's index. Call cleanup when done
+func snapshotWorktree(repoPath string) (*worktreeSnapshot, error) {
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "--git-path", "index").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error finding git index: %w", err)
+	}
+	realIndex := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(realIndex) {
+		realIndex = filepath.Join(repoPath, realIndex)
+	}
+
+	tmp, err := os.CreateTemp("", "repository-mapper-index")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	s := &worktreeSnapshot{repoPath: repoPath, indexFile: tmp.Name()}
+
+	// Starting from the real index means git can skip re-hashing files which haven't changed
+	data, err := os.ReadFile(realIndex)
+	if err == nil {
+		err = os.WriteFile(s.indexFile, data, 0600)
+	} else if os.IsNotExist(err) {
+		err = os.Remove(s.indexFile)
+	}
+	if err != nil {
+		s.cleanup()
+		return nil, err
+	}
+
+	_, err = s.git("add", "--all")
+	if err != nil {
+		s.cleanup()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *worktreeSnapshot) cleanup() {
+	os.Remove(s.indexFile)
+}
+
+// Run a git command against the snapshot's index
+func (s *worktreeSnapshot) git(args ...string) ([]byte, error) {
+	c := exec.Command("git", args...)
+	c.Dir = s.repoPath
+	c.Env = append(os.Environ(), "GIT_INDEX_FILE="+s.indexFile)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	c.Stdout = stdout
+	c.Stderr = stderr
+	err := c.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running git %s: %s: %s", args[0], err, stderr)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Diff the snapshot against base, e.g. the commit the branch was created from
+func (s *worktreeSnapshot) diff(base string, args ...string) ([]byte, error) {
+	return s.git(append(append([]string{"diff", "--cached", "--no-renames"}, args...), base, "--")...)
+}
+
+// List every file changed since base
+func (s *worktreeSnapshot) changedFiles(base string) ([]*fileChange, error) {
+	nameStatus, err := s.diff(base, "--name-status", "-z")
+	if err != nil {
+		return nil, err
+	}
+	numStat, err := s.diff(base, "--numstat", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*fileChange
+	byPath := map[string]*fileChange{}
+	// Entries are "<status>\0<path>\0"
+	fields := strings.Split(strings.TrimSuffix(string(nameStatus), "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		c := &fileChange{Status: fields[i], Path: fields[i+1]}
+		changes = append(changes, c)
+		byPath[c.Path] = c
+	}
+	// Entries are "<added>\t<removed>\t<path>\0", with "-" counts for binary files
+	for _, entry := range strings.Split(strings.TrimSuffix(string(numStat), "\x00"), "\x00") {
+		parts := strings.SplitN(entry, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		c, ok := byPath[parts[2]]
+		if !ok {
+			continue
+		}
+		if parts[0] == "-" {
+			c.Binary = true
+			continue
+		}
+		c.Added, _ = strconv.Atoi(parts[0])
+		c.Removed, _ = strconv.Atoi(parts[1])
+	}
+	return changes, nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// A rule committing changes to matching paths separately from the rest
+type commitSplit struct {
+	// Globs of the paths to commit separately, e.g. "vendor/**"
+	Paths []string `json:"paths"`
+	// Message for the separate commit
+	Message string `json:"message"`
+}
+
+// Check every commit split rule is usable
+func validateCommitSplits(splits []*commitSplit) error {
+	for i, split := range splits {
+		if split.Message == "" {
+			return fmt.Errorf("rule %d has no message", i+1)
+		}
+		if len(split.Paths) == 0 {
+			return fmt.Errorf("rule '%s' has no paths", split.Message)
+		}
+		for _, pattern := range split.Paths {
+			err := validateGlob(pattern)
+			if err != nil {
+				return fmt.Errorf("rule '%s' has an invalid path '%s': %w", split.Message, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Index of the first rule matching the path, or -1 if none do
+func (c *config) commitSplitFor(path string) int {
+	for i, split := range c.CommitSplits {
+		for _, pattern := range split.Paths {
+			if matchGlob(pattern, path) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Commit the changed files in st in groups: first everything not matching a rule using message,
+// then the files matching each rule in the order the rules are configured
+func commitSplitChanges(repoName string, wt *git.Worktree, st git.Status, message string) error {
+	groups := make([][]string, len(cfg.CommitSplits))
+	var rest []string
+	for path := range st {
+		i := cfg.commitSplitFor(path)
+		if i < 0 {
+			rest = append(rest, path)
+		} else {
+			groups[i] = append(groups[i], path)
+		}
+	}
+
+	commitGroup := func(paths []string, message string) error {
+		if len(paths) == 0 {
+			return nil
+		}
+		sort.Strings(paths)
+		err := stageFiles(wt.Filesystem.Root(), paths)
+		if err != nil {
+			return err
+		}
+		return commitIndex(repoName, wt, message)
+	}
+
+	err := commitGroup(rest, message)
+	if err != nil {
+		return err
+	}
+	for i, split := range cfg.CommitSplits {
+		err = commitGroup(groups[i], split.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stage additions, modifications and deletions of exactly the given paths.
+// The paths are passed to git on stdin since a large change, e.g. to vendor/, can exceed the argument limit
+func stageFiles(repoPath string, paths []string) error {
+	addCmd := exec.Command("git", "--literal-pathspecs", "add", "--all", "--pathspec-from-file=-", "--pathspec-file-nul")
+	addCmd.Dir = repoPath
+	addCmd.Stdin = strings.NewReader(strings.Join(paths, "\x00"))
+	stderr := &bytes.Buffer{}
+	addCmd.Stderr = stderr
+	err := addCmd.Run()
+	if err != nil {
+		return fmt.Errorf("error adding changes: %s: %s", err, stderr)
+	}
+	return nil
+}
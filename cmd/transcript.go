@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Default for --max-transcript-bytes
+	defaultMaxTranscriptBytes = 1 << 20
+	// Output without newlines, e.g. progress bars, is written out once this much has built up
+	maxLineBytes = 64 << 10
+)
+
+var (
+	stream             bool
+	maxTranscriptBytes = defaultMaxTranscriptBytes
+)
+
+// Register the flags controlling how script output is shown and recorded
+func addTranscriptFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&stream, "stream", false, "(optional) Show the script's output live, prefixed with the repo name")
+	cmd.Flags().IntVar(&maxTranscriptBytes, "max-transcript-bytes", defaultMaxTranscriptBytes, "(optional) Maximum size of each stdout/stderr kept in the results, 0 for no limit. Full transcripts are always written to ./results/<branch-name>.<timestamp>/")
+}
+
+// Path of the file the full stdout or stderr of a repo's commands in this run is written to
+func transcriptPath(repoName, name string) string {
+	return filepath.Join(".", "results", runName(), repoName+"."+name)
+}
+
+// Remove the transcripts of a previous run of the repo, so they only hold the output of this one
+func resetTranscripts(repoName string) error {
+	for _, name := range []string{"stdout", "stderr"} {
+		err := os.Remove(transcriptPath(repoName, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run one of the campaign's commands (the script, a pipeline step, the verify command or applying the patch) in dir.
+// Like runCommandContext, but the output is also shown live with --stream and appended to the repo's transcript files
+// under a header line naming the command, and only up to --max-transcript-bytes of each stream is kept in memory
+func runTranscribedCommand(ctx context.Context, repoName string, label string, dir string, name string, args ...string) (stdoutBytes []byte, stderrBytes []byte, exitCode int, err error) {
+	stdoutFile, err := openTranscript(repoName, "stdout")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer stdoutFile.Close()
+	stderrFile, err := openTranscript(repoName, "stderr")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer stderrFile.Close()
+	for _, f := range []*os.File{stdoutFile, stderrFile} {
+		_, err = fmt.Fprintf(f, "==> %s <==\n", label)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("error writing transcript: %w", err)
+		}
+	}
+
+	redact := credentialRedactor()
+	stdout := newCappedBuffer(maxTranscriptBytes, transcriptPath(repoName, "stdout"))
+	stderr := newCappedBuffer(maxTranscriptBytes, transcriptPath(repoName, "stderr"))
+	// Output is redacted line by line before it's capped, so a credential is never cut apart where it couldn't be matched
+	stdoutWriters := []io.Writer{newLineWriter(stdout, "", redact), newLineWriter(stdoutFile, "", redact)}
+	stderrWriters := []io.Writer{newLineWriter(stderr, "", redact), newLineWriter(stderrFile, "", redact)}
+	if stream {
+		stdoutWriters = append(stdoutWriters, newLineWriter(os.Stdout, repoName+": ", redact))
+		stderrWriters = append(stderrWriters, newLineWriter(os.Stderr, repoName+": ", redact))
+	}
+	stdoutWriter := io.MultiWriter(stdoutWriters...)
+	stderrWriter := io.MultiWriter(stderrWriters...)
+
+	exitCode, err = runCommandWriters(ctx, dir, stdoutWriter, stderrWriter, name, args...)
+	// Output without a trailing newline is still waiting in the line writers
+	for _, w := range append(stdoutWriters, stderrWriters...) {
+		if lw, ok := w.(*lineWriter); ok {
+			lw.Flush()
+		}
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return stdout.Bytes(), stderr.Bytes(), exitCode, nil
+}
+
+func openTranscript(repoName, name string) (*os.File, error) {
+	fp := transcriptPath(repoName, name)
+	// Transcripts may contain sensitive output so only the current user can read them
+	err := os.MkdirAll(filepath.Dir(fp), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("error creating transcript directory: %w", err)
+	}
+	f, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening transcript: %w", err)
+	}
+	return f, nil
+}
+
+// Apply redact to every line of the repo's transcript files, e.g. to mask secrets found after the script ran
+func redactTranscripts(repoName string, redact func(string) string) error {
+	for _, name := range []string{"stdout", "stderr"} {
+		fp := transcriptPath(repoName, name)
+		data, err := os.ReadFile(fp)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(fp, []byte(redact(string(data))), 0600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keeps the start and end of everything written to it, dropping the middle once it exceeds limit bytes
+type cappedBuffer struct {
+	limit int
+	// Where the full output can be found, mentioned in the truncation marker
+	fullPath string
+	head     []byte
+	tail     []byte
+	written  int
+}
+
+func newCappedBuffer(limit int, fullPath string) *cappedBuffer {
+	return &cappedBuffer{limit: limit, fullPath: fullPath}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.written += n
+	if b.limit <= 0 {
+		b.head = append(b.head, p...)
+		return n, nil
+	}
+	headLimit := b.limit / 2
+	if room := headLimit - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+	b.tail = append(b.tail, p...)
+	// Trim occasionally rather than on every write, the tail is at most twice its limit
+	tailLimit := b.limit - headLimit
+	if len(b.tail) > 2*tailLimit {
+		b.tail = append([]byte{}, b.tail[len(b.tail)-tailLimit:]...)
+	}
+	return n, nil
+}
+
+// Everything written if it fit within the limit, otherwise its start and end around a truncation marker
+func (b *cappedBuffer) Bytes() []byte {
+	if b.limit <= 0 || b.written <= b.limit {
+		return append(append([]byte{}, b.head...), b.tail...)
+	}
+	tail := b.tail
+	if tailLimit := b.limit - b.limit/2; len(tail) > tailLimit {
+		tail = tail[len(tail)-tailLimit:]
+	}
+	marker := fmt.Sprintf("\n... [truncated %d of %d bytes, full transcript in %s] ...\n", b.written-len(b.head)-len(tail), b.written, b.fullPath)
+	return append(append(append([]byte{}, b.head...), marker...), tail...)
+}
+
+// Writes whole lines to w, each with a prefix and passed through redact
+type lineWriter struct {
+	w       io.Writer
+	prefix  string
+	redact  func(string) string
+	partial []byte
+}
+
+func newLineWriter(w io.Writer, prefix string, redact func(string) string) *lineWriter {
+	return &lineWriter{w: w, prefix: prefix, redact: redact}
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.partial = append(lw.partial, p...)
+	for {
+		i := bytes.IndexByte(lw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lw.writeLine(string(lw.partial[:i+1]))
+		lw.partial = lw.partial[i+1:]
+	}
+	if len(lw.partial) >= maxLineBytes {
+		lw.writeLine(string(lw.partial))
+		lw.partial = nil
+	}
+	// Terminal and file errors shouldn't fail the script, its output is still collected
+	return len(p), nil
+}
+
+// Write out any incomplete last line
+func (lw *lineWriter) Flush() {
+	if len(lw.partial) == 0 {
+		return
+	}
+	line := string(lw.partial)
+	if lw.prefix != "" {
+		// Prefixed output is interleaved with other logs, so always end it with a newline
+		line += "\n"
+	}
+	lw.writeLine(line)
+	lw.partial = nil
+}
+
+func (lw *lineWriter) writeLine(line string) {
+	io.WriteString(lw.w, lw.prefix+lw.redact(line))
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Outcome of repos which errored before producing results, only used for triage
+const outcomeError = "error"
+
+// Number of example repos shown for each cluster in the summary
+const triageExamples = 3
+
+var (
+	triageFormat  string
+	clusterNumber int
+
+	// Parts of failure messages which differ between repos hitting the same problem, in the order they're replaced
+	triageUrlRegex     = regexp.MustCompile(`\S+://\S+`)
+	triagePathRegex    = regexp.MustCompile(`(?:[A-Za-z]:)?(?:~|\.{1,2})?/?[\w.@~+-]+(?:/[\w.@~+-]+)+/?|/[\w.@~+-]+`)
+	triageShaRegex     = regexp.MustCompile(`\b[0-9a-f]{7,64}\b`)
+	triageNumberRegex  = regexp.MustCompile(`\d+`)
+	triageSpaceRegex   = regexp.MustCompile(`\s+`)
+	triageMessageRegex = regexp.MustCompile(`(?i)error|fatal|fail|panic|cannot|denied|not found|no such`)
+)
+
+var triageCmd = &cobra.Command{
+	Use:   "triage [results-file]",
+	Short: "Group the failures in a results file by their error",
+	Long: `Group the failures in a results file by their error.
+
+The error of each failed or errored repository is normalised, replacing paths, URLs, SHAs, numbers and the
+repository's own name, and repositories with the same normalised error are grouped into a cluster. Each cluster is
+listed with its count, an example error and every repository in it, so each class of failure can be re-run separately.
+
+Reads ./results/<branch-name>.json with --branch-name, or the results file passed as an argument.`,
+	Args:         cobra.MaximumNArgs(1),
+	RunE:         runTriage,
+	SilenceUsage: true,
+}
+
+func init() {
+	triageCmd.Flags().StringVarP(&branchName, "branch-name", "b", "", "(optional) The campaign branch whose latest results to triage")
+	triageCmd.Flags().StringVar(&triageFormat, "output", outputText, "(optional) Format of the report, 'text' or 'json'")
+	triageCmd.Flags().IntVar(&clusterNumber, "cluster", 0, "(optional) Only print the repos of this cluster, one per line")
+	rootCmd.AddCommand(triageCmd)
+}
+
+// Failures sharing the same normalised error
+type triageCluster struct {
+	Outcome   string `json:"outcome"`
+	Signature string `json:"signature"`
+	// The error of the first repo in the cluster as it was printed
+	Example string   `json:"example"`
+	Repos   []string `json:"repos"`
+}
+
+func runTriage(cmd *cobra.Command, args []string) error {
+	if triageFormat != outputText && triageFormat != outputJson {
+		return fmt.Errorf("Unknown --output '%s', expected '%s' or '%s'", triageFormat, outputText, outputJson)
+	}
+	var fp string
+	switch {
+	case len(args) == 1:
+		fp = args[0]
+	case branchName != "":
+		fp = resultsPath()
+	default:
+		return fmt.Errorf("Pass a results file or --branch-name")
+	}
+	f, err := loadResultsFile(fp)
+	if err != nil {
+		return fmt.Errorf("error loading results: %w", err)
+	}
+
+	clusters := clusterFailures(f.Repos, f.Errors)
+	if clusterNumber != 0 {
+		if clusterNumber < 0 || clusterNumber > len(clusters) {
+			return fmt.Errorf("There is no cluster %d, %s has %d", clusterNumber, fp, len(clusters))
+		}
+		for _, repoName := range clusters[clusterNumber-1].Repos {
+			fmt.Println(repoName)
+		}
+		return nil
+	}
+
+	if triageFormat == outputJson {
+		// Keep the placeholders in signatures readable
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(clusters)
+	}
+	if len(clusters) == 0 {
+		fmt.Printf("No failures in %s\n", fp)
+		return nil
+	}
+	for i, c := range clusters {
+		fmt.Printf("%d. %d × %s: %s\n", i+1, len(c.Repos), c.Outcome, c.Signature)
+		fmt.Printf("   e.g. %s\n", c.Example)
+		fmt.Printf("   %s\n", strings.Join(c.Repos, " "))
+	}
+	return nil
+}
+
+// Group failed results and errored repos by their normalised error, largest cluster first
+func clusterFailures(results map[string]*runResults, errs map[string]string) []*triageCluster {
+	byKey := map[string]*triageCluster{}
+	add := func(repoName, outcome, message string) {
+		signature := normaliseFailure(message, repoName)
+		key := outcome + "\x00" + signature
+		c, ok := byKey[key]
+		if !ok {
+			c = &triageCluster{Outcome: outcome, Signature: signature, Example: message}
+			byKey[key] = c
+		}
+		c.Repos = append(c.Repos, repoName)
+	}
+
+	var repoNames []string
+	for repoName := range results {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	for _, repoName := range repoNames {
+		r := results[repoName]
+		if countsAsFailure(r.Outcome) {
+			add(repoName, r.Outcome, failureMessage(r))
+		}
+	}
+	repoNames = nil
+	for repoName := range errs {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	for _, repoName := range repoNames {
+		add(repoName, outcomeError, failureLine(errs[repoName]))
+	}
+
+	clusters := []*triageCluster{}
+	for _, c := range byKey {
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Repos) != len(clusters[j].Repos) {
+			return len(clusters[i].Repos) > len(clusters[j].Repos)
+		}
+		if clusters[i].Outcome != clusters[j].Outcome {
+			return clusters[i].Outcome < clusters[j].Outcome
+		}
+		return clusters[i].Signature < clusters[j].Signature
+	})
+	return clusters
+}
+
+// The line best describing why a repo failed
+func failureMessage(r *runResults) string {
+	switch {
+	case r.Outcome == outcomeVerifyFailed && r.Verify != nil:
+		if line := failureLine(r.Verify.Stderr); line != "" {
+			return line
+		}
+		return failureLine(r.Verify.Stdout)
+	case r.Outcome == outcomeGuardViolation && len(r.GuardViolations) > 0:
+		return r.GuardViolations[0]
+	case r.Outcome == outcomeSecretsFound && len(r.SecretFindings) > 0:
+		return fmt.Sprintf("Possible %s", r.SecretFindings[0].Rule)
+	}
+	if line := failureLine(r.Stderr); line != "" {
+		return line
+	}
+	if line := failureLine(r.Stdout); line != "" {
+		return line
+	}
+	return fmt.Sprintf("exited with %d", r.ExitCode)
+}
+
+// The first line of some output which looks like an error, or its first line if none do
+func failureLine(text string) string {
+	lines := splitLines(text)
+	for _, line := range lines {
+		if triageMessageRegex.MatchString(line) {
+			return strings.TrimSpace(line)
+		}
+	}
+	if len(lines) > 0 {
+		return strings.TrimSpace(lines[0])
+	}
+	return ""
+}
+
+// Replace the parts of a failure message which differ between repos hitting the same problem
+func normaliseFailure(message, repoName string) string {
+	message = triageUrlRegex.ReplaceAllString(message, "<url>")
+	message = triagePathRegex.ReplaceAllString(message, "<path>")
+	for _, name := range []string{repoName, pathBase(repoName)} {
+		if name != "" {
+			// Only whole names, so a repo called e.g. api doesn't mangle "rapid"
+			message = regexp.MustCompile(`\b`+regexp.QuoteMeta(name)+`\b`).ReplaceAllString(message, "<repo>")
+		}
+	}
+	message = triageShaRegex.ReplaceAllString(message, "<sha>")
+	message = triageNumberRegex.ReplaceAllString(message, "<n>")
+	return strings.TrimSpace(triageSpaceRegex.ReplaceAllString(message, " "))
+}
+
+// Last element of a slash separated name, e.g. the directory of a local repo
+func pathBase(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// Print the failures of a run grouped by their error
+func printTriage(results map[string]*runResults, errs map[string]string) {
+	clusters := clusterFailures(results, errs)
+	if len(clusters) == 0 {
+		return
+	}
+	fmt.Println("\n===============")
+	fmt.Println("🧩 FAILURES BY ERROR 🧩")
+	fmt.Println("===============")
+	for i, c := range clusters {
+		examples := c.Repos
+		more := ""
+		if len(examples) > triageExamples {
+			examples = examples[:triageExamples]
+			more = fmt.Sprintf(" (+%d more)", len(c.Repos)-triageExamples)
+		}
+		fmt.Printf("%d. %d × %s: %s\n", i+1, len(c.Repos), c.Outcome, c.Signature)
+		fmt.Printf("   %s%s\n", strings.Join(examples, ", "), more)
+	}
+	// The run's own log holds exactly these failures, and is written by every command including plan
+	fmt.Printf("List every repo of each cluster with: repository-mapper triage %s\n", runResultsPath(".jsonl"))
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Results from running the --verify command
+type verifyResults struct {
+	Command    string `json:"command"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Run the --verify command after a successful change, marking the results as outcomeVerifyFailed if it fails
+func verifyRepo(repoName, repoPath string, r *runResults) error {
+	if verifyCommand == "" || !outcomeAllowsPr(r.Outcome) {
+		return nil
+	}
+
+	fmt.Printf("%s: 🔍 Verifying changes\n", repoName)
+	start := time.Now()
+	stdout, stderr, exitCode, err := runTranscribedCommand(context.Background(), repoName, "verify", repoPath, "sh", "-c", verifyCommand)
+	if err != nil {
+		return fmt.Errorf("error running verify command: %w", err)
+	}
+	r.Verify = &verifyResults{
+		Command:    verifyCommand,
+		Stdout:     string(stdout),
+		Stderr:     string(stderr),
+		ExitCode:   exitCode,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if exitCode != 0 {
+		r.Outcome = outcomeVerifyFailed
+	}
+	return nil
+}
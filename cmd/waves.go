@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// States the pull requests of a wave can be required to reach before continue starts the next one
+const (
+	requireMerged = "merged"
+	requireChecks = "checks"
+)
+
+// Progress of a campaign whose pull requests are opened in waves, saved between runs so continue can open the next wave
+type rollout struct {
+	campaign
+	// Total number of pull requests which may be open after each wave, from --waves
+	Waves []int `json:"waves,omitempty"`
+	// Number of pull requests each wave may open, from --max-prs
+	MaxPrs int `json:"maxPrs,omitempty"`
+	// Number of waves run so far
+	Wave int `json:"wave"`
+	// Number of pull requests opened so far
+	PullRequests int `json:"pullRequests"`
+	// Pull requests opened by the last wave, checked by continue --require
+	WavePullRequests []string `json:"wavePullRequests"`
+	// Repos which haven't been run yet, in the order they were given
+	Pending []string `json:"pending"`
+}
+
+var (
+	wavesSpec string
+	maxPrs    int
+	require   string
+)
+
+var continueCmd = &cobra.Command{
+	Use:   "continue",
+	Short: "Open the next wave of pull requests of a campaign started with --waves or --max-prs",
+	Long: `Open the next wave of pull requests of a campaign started with --waves or --max-prs.
+
+Runs the campaign exactly as it was started in the next repositories still pending, until the wave's share of pull
+requests have been opened. With --require the wave only starts once every pull request of the previous wave is merged
+or has passing checks.`,
+	Args:         cobra.NoArgs,
+	RunE:         runContinue,
+	SilenceUsage: true,
+}
+
+func init() {
+	continueCmd.Flags().StringVarP(&branchName, "branch-name", "b", "", "The campaign branch to continue.")
+	continueCmd.MarkFlagRequired("branch-name")
+	addOutputFlags(continueCmd)
+	continueCmd.Flags().BoolVar(&noTui, "no-tui", false, "(optional) Show plain line logs instead of the live progress view when stdout is a terminal")
+	continueCmd.Flags().StringVar(&require, "require", "", "(optional) Only continue once every PR of the previous wave is 'merged' or has passing 'checks'")
+	addEnvFlags(continueCmd)
+	addSecretScanFlags(continueCmd)
+	addAuthFlags(continueCmd)
+	rootCmd.AddCommand(continueCmd)
+}
+
+// Path of the rollout state for the current branch
+func rolloutPath() string {
+	return filepath.Join(".", "results", resultsName()+".rollout.json")
+}
+
+// Parse --waves, e.g. "5,25,100%", into the total number of pull requests which may be open after each wave.
+// Percentages are of the number of repos
+func parseWaves(spec string, repoCount int) ([]int, error) {
+	var waves []int
+	prev := 0
+	for _, s := range strings.Split(spec, ",") {
+		n, err := parseWave(s, repoCount)
+		if err != nil {
+			return nil, err
+		}
+		// Waves beyond every repo would never open anything
+		if n > repoCount {
+			n = repoCount
+		}
+		if n < prev {
+			return nil, fmt.Errorf("invalid wave '%s', waves must not get smaller", strings.TrimSpace(s))
+		}
+		if n > prev {
+			waves = append(waves, n)
+		}
+		prev = n
+	}
+	return waves, nil
+}
+
+// Parse a single wave of --waves into a number of pull requests
+func parseWave(s string, repoCount int) (int, error) {
+	s = strings.TrimSpace(s)
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid wave '%s', percentages must be between 0 and 100", s)
+		}
+		return int(math.Ceil(float64(repoCount) * p / 100)), nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid wave '%s', expected a positive number or percentage", s)
+	}
+	return n, nil
+}
+
+// Check the rollout flags
+func validateRolloutArgs() error {
+	if !makePr {
+		return fmt.Errorf("--waves and --max-prs limit the pull requests opened, so they require --make-pr")
+	}
+	if maxPrs < 0 {
+		return fmt.Errorf("--max-prs can't be negative")
+	}
+	if wavesSpec != "" {
+		// Percentages can only be resolved once the repos are known, so just check each wave is well formed
+		for _, s := range strings.Split(wavesSpec, ",") {
+			_, err := parseWave(s, 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Start a rollout of the current campaign across the repos
+func newRollout(repoNames []string) (*rollout, error) {
+	ro := &rollout{MaxPrs: maxPrs, Pending: repoNames}
+	var err error
+	ro.campaign, err = currentCampaign()
+	if err != nil {
+		return nil, err
+	}
+	if wavesSpec != "" {
+		ro.Waves, err = parseWaves(wavesSpec, len(repoNames))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ro, nil
+}
+
+// Number of pull requests the next wave may open, -1 for no limit
+func (ro *rollout) limit() int {
+	if ro.MaxPrs > 0 {
+		return ro.MaxPrs
+	}
+	if ro.Wave < len(ro.Waves) {
+		return ro.Waves[ro.Wave] - ro.PullRequests
+	}
+	// Every repo left is run once the waves are used up
+	return -1
+}
+
+// Run the next wave of the rollout, adding its results to allResults
+func (ro *rollout) runWave(allResults map[string]*runResults) map[string]*runResults {
+	fmt.Printf("Starting wave %d, %d repos pending\n", ro.Wave+1, len(ro.Pending))
+	results, pending := runRepos(ro.Pending, ro.limit())
+
+	ro.Wave++
+	ro.Pending = pending
+	ro.WavePullRequests = nil
+	for repoName, r := range results {
+		allResults[repoName] = r
+		if r.PullRequest != "" {
+			ro.WavePullRequests = append(ro.WavePullRequests, r.PullRequest)
+		}
+	}
+	ro.PullRequests += len(ro.WavePullRequests)
+	return results
+}
+
+// Save the rollout and explain how to continue it
+func (ro *rollout) save() error {
+	data, err := json.MarshalIndent(ro, "", "  ")
+	if err != nil {
+		return err
+	}
+	fp := rolloutPath()
+	err = os.WriteFile(fp, data, 0600)
+	if err != nil {
+		return err
+	}
+	if len(ro.Pending) == 0 {
+		fmt.Printf("Rollout complete after %d waves, %d pull requests opened\n", ro.Wave, ro.PullRequests)
+		return nil
+	}
+	fmt.Printf("Wave %d opened %d pull requests, %d repos pending. Progress saved in %s\n", ro.Wave, len(ro.WavePullRequests), len(ro.Pending), fp)
+	fmt.Printf("Start the next wave with: repository-mapper continue -b %s\n", ro.BranchName)
+	return nil
+}
+
+func loadRollout(fp string) (*rollout, error) {
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	ro := &rollout{}
+	err = json.Unmarshal(data, ro)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fp, err)
+	}
+	return ro, nil
+}
+
+// Check every pull request of the last wave has reached the required state, returning the ones which haven't
+func (ro *rollout) waveNotReady(required string) ([]string, error) {
+	var notReady []string
+	for _, prURL := range ro.WavePullRequests {
+		var ready bool
+		switch required {
+		case requireMerged:
+			state, err := pullRequestState(prURL)
+			if err != nil {
+				return nil, err
+			}
+			ready = state == "MERGED"
+		case requireChecks:
+			// gh exits non-zero while any check is failing or pending
+			err := exec.Command("gh", "pr", "checks", prURL).Run()
+			if _, ok := err.(*exec.ExitError); err != nil && !ok {
+				return nil, fmt.Errorf("error getting pull request checks: %w", err)
+			}
+			ready = err == nil
+		}
+		if !ready {
+			notReady = append(notReady, prURL)
+		}
+	}
+	return notReady, nil
+}
+
+// Open the next wave of pull requests
+func runContinue(cmd *cobra.Command, args []string) error {
+	if require != "" && require != requireMerged && require != requireChecks {
+		return fmt.Errorf("Unknown --require '%s', expected '%s' or '%s'", require, requireMerged, requireChecks)
+	}
+	ro, err := loadRollout(rolloutPath())
+	if err != nil {
+		return fmt.Errorf("error loading rollout: %w", err)
+	}
+	if len(ro.Pending) == 0 {
+		fmt.Printf("Rollout of %s is already complete\n", ro.BranchName)
+		return nil
+	}
+	err = ro.restore()
+	if err != nil {
+		return err
+	}
+
+	if require != "" {
+		notReady, err := ro.waveNotReady(require)
+		if err != nil {
+			return err
+		}
+		if len(notReady) > 0 {
+			return fmt.Errorf("%d pull requests of wave %d aren't %s yet:\n%s", len(notReady), ro.Wave, require, strings.Join(notReady, "\n"))
+		}
+	}
+
+	allResults, err := loadResults(resultsPath())
+	if err != nil {
+		return fmt.Errorf("error loading results: %w", err)
+	}
+	results := ro.runWave(allResults)
+
+	summarizeResults(results)
+
+	err = saveResults(allResults)
+	if err != nil {
+		return fmt.Errorf("error saving results: %s\n", err)
+	}
+	err = ro.save()
+	if err != nil {
+		return err
+	}
+	return checkFailures(results)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWaves(t *testing.T) {
+	tests := []struct {
+		spec      string
+		repoCount int
+		want      []int
+		wantErr   bool
+	}{
+		{spec: "5,25,100%", repoCount: 200, want: []int{5, 25, 200}},
+		{spec: "5,25,100%", repoCount: 10, want: []int{5, 10}},
+		{spec: "10%,50%", repoCount: 15, want: []int{2, 8}},
+		{spec: "50%,10", repoCount: 10, want: []int{5, 10}},
+		{spec: "1, 1, 3", repoCount: 10, want: []int{1, 3}},
+		{spec: "10,5", repoCount: 20, wantErr: true},
+		{spec: "50%,10", repoCount: 40, wantErr: true},
+		{spec: "0", repoCount: 10, wantErr: true},
+		{spec: "x", repoCount: 10, wantErr: true},
+		{spec: "150%", repoCount: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWaves(tt.spec, tt.repoCount)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWaves(%q, %d) error = %v, want error %t", tt.spec, tt.repoCount, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWaves(%q, %d) = %v, want %v", tt.spec, tt.repoCount, got, tt.want)
+		}
+	}
+}